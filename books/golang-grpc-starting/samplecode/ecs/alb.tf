@@ -13,9 +13,29 @@ resource "aws_lb_listener" "myecs" {
   certificate_arn = data.aws_acm_certificate.myecs.arn
 
   default_action {
+    type             = "forward"
+    target_group_arn = aws_lb_target_group.myecs_http.arn
+  }
+}
+
+# gRPCのリクエストだけをGRPCのターゲットグループに送る
+# それ以外(ゲートウェイ、/metrics、/healthz)はHTTP/1.1のターゲットグループに送る
+# どちらも同じコンテナの同じポートに届き、サーバー側で振り分けられる
+resource "aws_lb_listener_rule" "myecs_grpc" {
+  listener_arn = aws_lb_listener.myecs.arn
+  priority     = 10
+
+  action {
     type             = "forward"
     target_group_arn = aws_lb_target_group.myecs.arn
   }
+
+  condition {
+    http_header {
+      http_header_name = "content-type"
+      values           = ["application/grpc*"]
+    }
+  }
 }
 
 resource "aws_lb_target_group" "myecs" {
@@ -23,7 +43,7 @@ resource "aws_lb_target_group" "myecs" {
 
   protocol         = "HTTP"
   protocol_version = "GRPC"
-  port             = 8080
+  port             = local.server_port
 
   vpc_id      = data.aws_vpc.myecs.id
   target_type = "ip"
@@ -45,6 +65,33 @@ resource "aws_lb_target_group" "myecs" {
   }
 }
 
+resource "aws_lb_target_group" "myecs_http" {
+  name = join("-", [var.base_name, "http", "tg"])
+
+  protocol         = "HTTP"
+  protocol_version = "HTTP1"
+  port             = local.server_port
+
+  vpc_id      = data.aws_vpc.myecs.id
+  target_type = "ip"
+
+  health_check {
+    enabled             = true
+    healthy_threshold   = 5
+    unhealthy_threshold = 2
+    timeout             = 5
+    interval            = 30
+    matcher             = "200"
+
+    path = "/healthz"
+    port = "traffic-port"
+  }
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
 resource "aws_security_group" "myecs_alb" {
   name   = join("-", [var.base_name, "alb", "sg"])
   vpc_id = data.aws_vpc.myecs.id
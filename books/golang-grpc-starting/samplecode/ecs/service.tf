@@ -11,7 +11,13 @@ resource "aws_ecs_service" "myecs" {
   load_balancer {
     target_group_arn = aws_lb_target_group.myecs.arn
     container_name   = "gRPC-server"
-    container_port   = 8080
+    container_port   = local.server_port
+  }
+
+  load_balancer {
+    target_group_arn = aws_lb_target_group.myecs_http.arn
+    container_name   = "gRPC-server"
+    container_port   = local.server_port
   }
 
   network_configuration {
@@ -33,8 +39,8 @@ resource "aws_security_group" "myecs_service" {
   }
 
   ingress {
-    from_port       = 8080
-    to_port         = 8080
+    from_port       = local.server_port
+    to_port         = local.server_port
     protocol        = "tcp"
     security_groups = [aws_security_group.myecs_alb.id]
   }
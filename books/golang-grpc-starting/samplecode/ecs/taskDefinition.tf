@@ -7,30 +7,9 @@ resource "aws_ecs_task_definition" "myecs" {
   cpu          = 256
   memory       = 512
 
+  # gRPCサーバーのコンテナ定義はサーバーの設定からserver.tfに生成される
   container_definitions = jsonencode([
-    {
-      name      = "gRPC-server"
-      image     = "${data.aws_ecr_repository.myecs.repository_url}:${var.image_tag}"
-      essential = true
-      portMappings = [
-        {
-          containerPort = 8080
-          hostPort      = 8080
-        }
-      ]
-      logConfiguration = {
-        logDriver = "awsfirelens"
-        options = {
-          Name              = "cloudwatch"
-          region            = var.region
-          log_group_name    = join("/", ["ecs", var.base_name])
-          log_stream_prefix = "grpc"
-        }
-      }
-      healthCheck = {
-        command = ["CMD-SHELL", "/bin/grpc_health_probe -addr=:8080 || exit 1"]
-      }
-    },
+    local.server_container,
     {
       name      = "log-router"
       image     = "public.ecr.aws/aws-observability/aws-for-fluent-bit:stable"
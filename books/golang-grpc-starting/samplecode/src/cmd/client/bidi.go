@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	hellopb "mygrpc/pkg/grpc"
+)
+
+// runBidi はHelloBiStreamsの送信と受信を別々のgoroutineで行う
+// nextが返す名前を送信し、受け取った応答ごとにonResponseを呼ぶ
+// 応答を待っている送信済みのメッセージはmaxInFlight件までに抑える(0以下なら無制限)
+// streamはctxから作られている必要があり、受信側が終わるとcancelで送信側も止める
+// nextはctxが終わったら入力を待たずに戻らなければならない。runBidiは送信側が終わるのを待ってから戻る
+func runBidi(ctx context.Context, cancel context.CancelFunc, stream hellopb.GreetingService_HelloBiStreamsClient, maxInFlight int, next func(context.Context) (string, bool), onResponse func(*hellopb.HelloResponse) error) error {
+	defer cancel()
+
+	var inFlight chan struct{}
+	if maxInFlight > 0 {
+		inFlight = make(chan struct{}, maxInFlight)
+	}
+
+	sendDone := make(chan error, 1)
+	go func() {
+		sendDone <- sendLoop(ctx, stream, inFlight, next)
+	}()
+
+	err := recvLoop(stream, inFlight, onResponse)
+	// 受信側が終わった後は、送信側が入力やmaxInFlightの空きを待っていても止めてよい
+	// 止めた送信側がnextを呼び続けないように、終わるまで待つ
+	cancel()
+	sendErr := <-sendDone
+	if err != nil {
+		return err
+	}
+	if sendErr != nil && !errors.Is(sendErr, context.Canceled) {
+		return sendErr
+	}
+	return nil
+}
+
+func recvLoop(stream hellopb.GreetingService_HelloBiStreamsClient, inFlight chan struct{}, onResponse func(*hellopb.HelloResponse) error) error {
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if inFlight != nil {
+			select {
+			case <-inFlight:
+			default:
+			}
+		}
+		if err := onResponse(res); err != nil {
+			return err
+		}
+	}
+}
+
+func sendLoop(ctx context.Context, stream hellopb.GreetingService_HelloBiStreamsClient, inFlight chan struct{}, next func(context.Context) (string, bool)) error {
+	for {
+		name, ok := next(ctx)
+		if !ok {
+			return stream.CloseSend()
+		}
+		if inFlight != nil {
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := stream.Send(&hellopb.HelloRequest{Name: name}); err != nil {
+			// 送信エラーの詳細は受信側のRecvで受け取る
+			return nil
+		}
+	}
+}
+
+// sliceNames はnamesを順に返すnextを作る
+func sliceNames(names []string) func(context.Context) (string, bool) {
+	var i int
+	return func(context.Context) (string, bool) {
+		if i >= len(names) {
+			return "", false
+		}
+		i++
+		return names[i-1], true
+	}
+}
+
+// chanNames はlinesから受け取った名前を最大n件まで返すnextを作る
+// ctxが終わるとlinesを読まずに戻るので、残りの入力は次にlinesを読む側に渡る
+func chanNames(lines <-chan string, n int) func(context.Context) (string, bool) {
+	var count int
+	return func(ctx context.Context) (string, bool) {
+		if count == n {
+			return "", false
+		}
+		select {
+		case name, ok := <-lines:
+			if !ok {
+				return "", false
+			}
+			count++
+			return name, true
+		case <-ctx.Done():
+			return "", false
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mygrpc/internal/grpctest"
+	hellopb "mygrpc/pkg/grpc"
+)
+
+// bufferingServer はリクエストをすべて先に読み込み、応答はゆっくり返す
+// 未応答のリクエスト数の最大値を記録する
+type bufferingServer struct {
+	hellopb.UnimplementedGreetingServiceServer
+
+	mu          sync.Mutex
+	pending     int
+	maxPending  int
+	replyPeriod time.Duration
+}
+
+func (s *bufferingServer) HelloBiStreams(stream hellopb.GreetingService_HelloBiStreamsServer) error {
+	reqs := make(chan *hellopb.HelloRequest, 1024)
+	go func() {
+		defer close(reqs)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.pending++
+			if s.pending > s.maxPending {
+				s.maxPending = s.pending
+			}
+			s.mu.Unlock()
+			reqs <- req
+		}
+	}()
+
+	for req := range reqs {
+		time.Sleep(s.replyPeriod)
+		s.mu.Lock()
+		s.pending--
+		s.mu.Unlock()
+		if err := stream.Send(&hellopb.HelloResponse{Message: req.GetName()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRunBidiMaxInFlight(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxInFlight int
+		wantMax     int
+	}{
+		{name: "limited", maxInFlight: 3, wantMax: 3},
+		{name: "unlimited", maxInFlight: 0, wantMax: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &bufferingServer{replyPeriod: 5 * time.Millisecond}
+			client, _ := grpctest.NewGreeting(t, srv)
+
+			names := make([]string, 20)
+			for i := range names {
+				names[i] = string(rune('a' + i))
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			stream, err := client.HelloBiStreams(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			err = runBidi(ctx, cancel, stream, tt.maxInFlight, sliceNames(names), func(res *hellopb.HelloResponse) error {
+				got = append(got, res.GetMessage())
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(names) {
+				t.Fatalf("got %d responses, want %d", len(got), len(names))
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if srv.maxPending > tt.wantMax {
+				t.Errorf("max pending = %d, want at most %d", srv.maxPending, tt.wantMax)
+			}
+			if tt.maxInFlight == 0 && srv.maxPending <= 3 {
+				t.Errorf("max pending = %d, want the sender not to wait for responses", srv.maxPending)
+			}
+		})
+	}
+}
+
+func TestRunBidiCancel(t *testing.T) {
+	client, _ := grpctest.NewGreeting(t, &bufferingServer{})
+
+	// 入力が来なくても、キャンセルで受信側がエラーになれば送信側も止まって戻る
+	next := chanNames(make(chan string), 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.HelloBiStreams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- runBidi(ctx, cancel, stream, 0, next, func(*hellopb.HelloResponse) error { return nil })
+	}()
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	select {
+	case err := <-done:
+		if err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("runBidi() = %v, want the cancellation error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("runBidi did not return")
+	}
+}
+
+func TestRunBidiSharedInput(t *testing.T) {
+	client, _ := grpctest.NewGreeting(t, &fakeServer{})
+
+	// 対話モードと同じく、2回のrunBidiで同じ入力を順に読む
+	lines := make(chan string)
+	start := func(t *testing.T) (<-chan []string, <-chan error) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		stream, err := client.HelloBiStreams(ctx)
+		if err != nil {
+			cancel()
+			t.Fatal(err)
+		}
+		gotc, errc := make(chan []string, 1), make(chan error, 1)
+		go func() {
+			var got []string
+			errc <- runBidi(ctx, cancel, stream, 0, chanNames(lines, 5), func(res *hellopb.HelloResponse) error {
+				got = append(got, res.GetMessage())
+				return nil
+			})
+			gotc <- got
+		}()
+		return gotc, errc
+	}
+
+	// 1回目は受信が失敗して終わる。送信側が次の入力を待っていても、戻る前に止まっている
+	_, errc := start(t)
+	lines <- ""
+	if err := <-errc; status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("first runBidi() = %v, want InvalidArgument", err)
+	}
+
+	// 残りの入力は2回目がすべて受け取る
+	gotc, errc := start(t)
+	lines <- "a"
+	lines <- "b"
+	close(lines)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-gotc, []string{"Hello, a!", "Hello, b!"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second runBidi() responses = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"mygrpc/pkg/clientpolicy"
+	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/interceptor/auth"
+	"mygrpc/pkg/loadbalance"
+	"mygrpc/pkg/serverconfig"
+	"mygrpc/pkg/tlsutil"
+	"mygrpc/pkg/tracing"
+)
+
+const usage = `usage: client [flags] [command] [command flags]
+
+commands:
+  hello          --name NAME        call Hello
+  server-stream  --name NAME [--count N] [--interval D]
+                                    call HelloServerStream
+  client-stream  --names a,b,c      call HelloClientStream
+  bidi           --file names.txt [--max-in-flight N]
+                                    call HelloBiStreams (one name per line, "-" for stdin)
+  reflect        list | describe SYMBOL | invoke [--data JSON] METHOD
+                                    explore and call the server through server reflection
+
+If no command is given, the client runs in interactive mode.
+`
+
+//go:embed service_config.json
+var defaultServiceConfig []byte
+
+// commonFlags はすべてのサブコマンドで共通のフラグ
+type commonFlags struct {
+	addr     string
+	metadata metadataFlag
+	timeout  time.Duration
+	tls      tlsutil.ClientConfig
+	token    string
+	// serviceConfig が空なら埋め込みのservice_config.jsonを使う
+	serviceConfig string
+	traceFile     string
+	// exporter はtracer()で開いたスパンの書き出し先。closeTracerで閉じる
+	exporter *tracing.WriterExporter
+	// lb は負荷分散のポリシー、healthService はバックエンドを選ぶ前に確認するサービス
+	lb            string
+	healthService string
+}
+
+func newCommonFlags() *commonFlags {
+	return &commonFlags{
+		addr:          "localhost:8080",
+		timeout:       10 * time.Second,
+		lb:            loadbalance.RoundRobin,
+		healthService: serverconfig.HealthService,
+	}
+}
+
+// register はフラグをfsに登録する
+// サブコマンドの前後どちらに書いても効くように、現在の値をデフォルト値にする
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.addr, "addr", c.addr, `address of the gRPC server, a comma separated list like "host1:8080,host2:8080=3" (=N sets the weight) or a target like "dns:///myapp:8080"`)
+	fs.Var(&c.metadata, "metadata", "outgoing metadata as k=v (repeatable)")
+	fs.DurationVar(&c.timeout, "timeout", c.timeout, "deadline of the RPC (0 means no deadline)")
+	fs.StringVar(&c.tls.CAFile, "tls-ca", c.tls.CAFile, "CA file to verify the server certificate (enables TLS)")
+	fs.StringVar(&c.tls.CertFile, "tls-cert", c.tls.CertFile, "client certificate file for mTLS")
+	fs.StringVar(&c.tls.KeyFile, "tls-key", c.tls.KeyFile, "client private key file for mTLS")
+	fs.StringVar(&c.tls.ServerName, "tls-server-name", c.tls.ServerName, "server name to verify (defaults to the host in --addr)")
+	fs.StringVar(&c.token, "token", c.token, "bearer token sent in the authorization metadata")
+	fs.StringVar(&c.serviceConfig, "service-config", c.serviceConfig, "JSON service config with timeouts, retry and hedging policies (defaults to the built-in one)")
+	fs.StringVar(&c.traceFile, "trace-file", c.traceFile, `file the client spans are appended to as JSON lines ("-" for stderr)`)
+	fs.StringVar(&c.lb, "lb", c.lb, `load balancing policy over the addresses: "round_robin", "weighted" or "pick_first"`)
+	fs.StringVar(&c.healthService, "health-service", c.healthService, `service checked on the health service before picking a backend ("" to disable)`)
+}
+
+// dialOptions はフラグから決まる接続オプションを返す
+func (c *commonFlags) dialOptions() ([]grpc.DialOption, error) {
+	creds, err := c.transportCredentials()
+	if err != nil {
+		return nil, err
+	}
+	sc, err := c.loadServiceConfig()
+	if err != nil {
+		return nil, err
+	}
+	switch c.lb {
+	case loadbalance.RoundRobin, loadbalance.Weighted:
+		// ヘルスチェックはpick_firstでは使われない
+		sc, err = sc.WithLoadBalancing(c.lb, c.healthService)
+	case "pick_first":
+		sc, err = sc.WithLoadBalancing(c.lb, "")
+	default:
+		err = fmt.Errorf("unknown load balancing policy %q", c.lb)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tracer, err := c.tracer()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(tracer.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(tracer.StreamClientInterceptor()),
+	}
+	opts = append(opts, clientpolicy.DialOptions(sc, nil)...)
+	if c.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(auth.NewTokenCredentials(c.token, c.tls.Enabled())))
+	}
+	return opts, nil
+}
+
+// rpcContext は--timeoutをデッドラインにしたコンテキストを返す
+func (c *commonFlags) rpcContext() (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(context.Background(), c.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// connect はフラグから決まる接続オプションにextraを加えてサーバーに接続する
+func (c *commonFlags) connect(ctx context.Context, extra ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts, err := c.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	return dial(ctx, c.addr, append(opts, extra...)...)
+}
+
+// tracer はtraceparentとリクエストIDを送るトレーサーを返す
+// スパンは--trace-fileが指定されたときだけ書き出す
+// 標準出力には結果のJSONを書くので、"-"は標準エラー出力にする
+func (c *commonFlags) tracer() (*tracing.Tracer, error) {
+	if c.traceFile == "" {
+		return tracing.NewTracer(nil), nil
+	}
+	if c.traceFile == "-" {
+		c.exporter = tracing.NewWriterExporter(os.Stderr)
+		return tracing.NewTracer(c.exporter), nil
+	}
+	e, err := tracing.NewFileExporter(c.traceFile)
+	if err != nil {
+		return nil, err
+	}
+	c.exporter = e
+	return tracing.NewTracer(e), nil
+}
+
+// closeTracer はtracer()で開いたファイルを閉じる
+func (c *commonFlags) closeTracer() error {
+	if c.exporter == nil {
+		return nil
+	}
+	err := c.exporter.Close()
+	c.exporter = nil
+	return err
+}
+
+func (c *commonFlags) loadServiceConfig() (*clientpolicy.ServiceConfig, error) {
+	if c.serviceConfig == "" {
+		return clientpolicy.ParseServiceConfig(defaultServiceConfig)
+	}
+	return clientpolicy.LoadServiceConfig(c.serviceConfig)
+}
+
+// transportCredentials はフラグに応じてTLSか平文のどちらかの認証情報を返す
+func (c *commonFlags) transportCredentials() (credentials.TransportCredentials, error) {
+	if !c.tls.Enabled() {
+		return insecure.NewCredentials(), nil
+	}
+	conf, err := tlsutil.NewClientTLSConfig(c.tls)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(conf), nil
+}
+
+// metadataFlag は k=v 形式で複数回指定できるフラグ
+type metadataFlag []string
+
+func (m *metadataFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *metadataFlag) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("metadata must be k=v: %q", v)
+	}
+	*m = append(*m, v)
+	return nil
+}
+
+func (m metadataFlag) md() metadata.MD {
+	md := metadata.MD{}
+	for _, kv := range m {
+		k, v, _ := strings.Cut(kv, "=")
+		md.Append(k, v)
+	}
+	return md
+}
+
+// result はサブコマンドの実行結果としてJSONで出力する内容
+type result struct {
+	Header    metadata.MD       `json:"header,omitempty"`
+	Trailer   metadata.MD       `json:"trailer,omitempty"`
+	Responses []json.RawMessage `json:"responses"`
+	Error     *errorResult      `json:"error,omitempty"`
+}
+
+type errorResult struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+func (r *result) addResponse(res *hellopb.HelloResponse) error {
+	return r.addMessage(res)
+}
+
+func (r *result) addMessage(res proto.Message) error {
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		return err
+	}
+	r.Responses = append(r.Responses, b)
+	return nil
+}
+
+func (r *result) setError(err error) {
+	stat := status.Convert(err)
+	r.Error = &errorResult{
+		Code:    stat.Code().String(),
+		Message: stat.Message(),
+	}
+	for _, d := range stat.Details() {
+		r.Error.Details = append(r.Error.Details, describeDetail(d))
+	}
+}
+
+var errRPCFailed = errors.New("rpc failed")
+
+// runCommand は非対話モードでサブコマンドを実行し、結果をJSONでwに書き出す
+// RPCがエラーで終わった場合もJSONを出力した上でerrRPCFailedを返す
+func runCommand(common *commonFlags, args []string, w io.Writer, dialOpts ...grpc.DialOption) error {
+	defer common.closeTracer()
+	cmd, args := args[0], args[1:]
+	if cmd == "reflect" {
+		return runReflect(common, args, w, dialOpts...)
+	}
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	common.register(fs)
+
+	var run func(ctx context.Context, client hellopb.GreetingServiceClient, r *result) error
+	switch cmd {
+	case "hello":
+		name := fs.String("name", "", "name to greet")
+		run = func(ctx context.Context, client hellopb.GreetingServiceClient, r *result) error {
+			return runHello(ctx, client, *name, r)
+		}
+	case "server-stream":
+		name := fs.String("name", "", "name to greet")
+		count := fs.Int("count", 0, "number of responses (0 for the server default)")
+		interval := fs.Duration("interval", -1, "interval between responses (negative for the server default)")
+		run = func(ctx context.Context, client hellopb.GreetingServiceClient, r *result) error {
+			req := &hellopb.HelloRequest{Name: *name}
+			if *count != 0 {
+				req.Count = proto.Int32(int32(*count))
+			}
+			if *interval >= 0 {
+				req.Interval = durationpb.New(*interval)
+			}
+			return runServerStream(ctx, client, req, r)
+		}
+	case "client-stream":
+		names := fs.String("names", "", "comma separated names to send")
+		run = func(ctx context.Context, client hellopb.GreetingServiceClient, r *result) error {
+			return runClientStream(ctx, client, splitNames(*names), r)
+		}
+	case "bidi":
+		file := fs.String("file", "-", `file that contains one name per line ("-" for stdin)`)
+		maxInFlight := fs.Int("max-in-flight", 0, "maximum number of names sent but not answered yet (0 for no limit)")
+		run = func(ctx context.Context, client hellopb.GreetingServiceClient, r *result) error {
+			names, err := readNames(*file)
+			if err != nil {
+				return err
+			}
+			return runBiStreams(ctx, client, names, *maxInFlight, r)
+		}
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := common.rpcContext()
+	defer cancel()
+	conn, err := common.connect(ctx, dialOpts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := hellopb.NewGreetingServiceClient(conn)
+
+	ctx = metadata.NewOutgoingContext(ctx, common.metadata.md())
+	r := &result{Responses: []json.RawMessage{}}
+	rpcErr := run(ctx, client, r)
+	if rpcErr != nil {
+		r.setError(rpcErr)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	if rpcErr != nil {
+		return errRPCFailed
+	}
+	return nil
+}
+
+func runHello(ctx context.Context, client hellopb.GreetingServiceClient, name string, r *result) error {
+	res, err := client.Hello(ctx, &hellopb.HelloRequest{Name: name}, grpc.Header(&r.Header), grpc.Trailer(&r.Trailer))
+	if err != nil {
+		return err
+	}
+	return r.addResponse(res)
+}
+
+func runServerStream(ctx context.Context, client hellopb.GreetingServiceClient, req *hellopb.HelloRequest, r *result) error {
+	stream, err := client.HelloServerStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		r.Header, _ = stream.Header()
+		r.Trailer = stream.Trailer()
+	}()
+
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.addResponse(res); err != nil {
+			return err
+		}
+	}
+}
+
+// splitNames はカンマ区切りの名前を分割する。空の要素は送らない
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func runClientStream(ctx context.Context, client hellopb.GreetingServiceClient, names []string, r *result) error {
+	stream, err := client.HelloClientStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		r.Header, _ = stream.Header()
+		r.Trailer = stream.Trailer()
+	}()
+
+	for _, name := range names {
+		if err := stream.Send(&hellopb.HelloRequest{Name: name}); err != nil {
+			// 送信エラーの詳細はCloseAndRecvで受け取る
+			break
+		}
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	return r.addResponse(res)
+}
+
+func runBiStreams(ctx context.Context, client hellopb.GreetingServiceClient, names []string, maxInFlight int, r *result) error {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := client.HelloBiStreams(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	defer func() {
+		r.Header, _ = stream.Header()
+		r.Trailer = stream.Trailer()
+	}()
+
+	return runBidi(ctx, cancel, stream, maxInFlight, sliceNames(names), r.addResponse)
+}
+
+func readNames(path string) ([]string, error) {
+	var f io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		f = file
+	}
+
+	var names []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if name := strings.TrimSpace(sc.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, sc.Err()
+}
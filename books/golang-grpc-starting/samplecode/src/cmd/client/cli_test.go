@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"mygrpc/internal/grpctest"
+	hellopb "mygrpc/pkg/grpc"
+)
+
+type fakeServer struct {
+	hellopb.UnimplementedGreetingServiceServer
+}
+
+func (s *fakeServer) Hello(ctx context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty name")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs("echo", md.Get("k")[0]))
+	grpc.SetTrailer(ctx, metadata.Pairs("in", "trailer"))
+	return &hellopb.HelloResponse{Message: fmt.Sprintf("Hello, %s!", req.GetName())}, nil
+}
+
+func (s *fakeServer) HelloServerStream(req *hellopb.HelloRequest, stream hellopb.GreetingService_HelloServerStreamServer) error {
+	for i := 0; i < 2; i++ {
+		if err := stream.Send(&hellopb.HelloResponse{Message: fmt.Sprintf("[%d] Hello, %s!", i, req.GetName())}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeServer) HelloClientStream(stream hellopb.GreetingService_HelloClientStreamServer) error {
+	var names []string
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&hellopb.HelloResponse{Message: fmt.Sprintf("Hello, %v!", names)})
+		}
+		if err != nil {
+			return err
+		}
+		names = append(names, req.GetName())
+	}
+}
+
+func (s *fakeServer) HelloBiStreams(stream hellopb.GreetingService_HelloBiStreamsServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.GetName() == "" {
+			return status.Error(codes.InvalidArgument, "empty name")
+		}
+		if err := stream.Send(&hellopb.HelloResponse{Message: fmt.Sprintf("Hello, %s!", req.GetName())}); err != nil {
+			return err
+		}
+	}
+}
+
+// newFakeServer はfakeServerをbufconn上に立てる
+func newFakeServer(t *testing.T) *grpctest.Server {
+	t.Helper()
+	return grpctest.NewServer(t, func(s *grpc.Server) {
+		hellopb.RegisterGreetingServiceServer(s, &fakeServer{})
+		reflection.Register(s)
+	})
+}
+
+func TestRunCommand(t *testing.T) {
+	dialer := newFakeServer(t).Dialer()
+
+	namesFile := filepath.Join(t.TempDir(), "names.txt")
+	if err := os.WriteFile(namesFile, []byte("a\nb\n\nc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantErr  bool
+		wantMsgs []string
+		check    func(t *testing.T, r result)
+	}{
+		{
+			name:     "hello",
+			args:     []string{"hello", "--name", "hsaki", "--metadata", "k=v"},
+			wantMsgs: []string{"Hello, hsaki!"},
+			check: func(t *testing.T, r result) {
+				if got := r.Header.Get("echo"); len(got) != 1 || got[0] != "v" {
+					t.Errorf("header echo = %v, want [v]", got)
+				}
+				if got := r.Trailer.Get("in"); len(got) != 1 || got[0] != "trailer" {
+					t.Errorf("trailer in = %v, want [trailer]", got)
+				}
+			},
+		},
+		{
+			name:    "hello error",
+			args:    []string{"hello"},
+			wantErr: true,
+			check: func(t *testing.T, r result) {
+				if r.Error == nil || r.Error.Code != "InvalidArgument" {
+					t.Errorf("error = %+v, want InvalidArgument", r.Error)
+				}
+			},
+		},
+		{
+			name:     "server-stream",
+			args:     []string{"server-stream", "--name", "hsaki"},
+			wantMsgs: []string{"[0] Hello, hsaki!", "[1] Hello, hsaki!"},
+		},
+		{
+			name:     "client-stream",
+			args:     []string{"client-stream", "--names", "a,b,c"},
+			wantMsgs: []string{"Hello, [a b c]!"},
+		},
+		{
+			name:     "client-stream without empty names",
+			args:     []string{"client-stream", "--names", "a,, b,"},
+			wantMsgs: []string{"Hello, [a b]!"},
+		},
+		{
+			name:     "client-stream with no names",
+			args:     []string{"client-stream", "--names", ""},
+			wantMsgs: []string{"Hello, []!"},
+		},
+		{
+			name:     "bidi",
+			args:     []string{"bidi", "--file", namesFile},
+			wantMsgs: []string{"Hello, a!", "Hello, b!", "Hello, c!"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runCommand(newCommonFlags(), tt.args, &out, dialer)
+			if tt.wantErr != errors.Is(err, errRPCFailed) {
+				t.Fatalf("runCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var r result
+			if err := json.Unmarshal(out.Bytes(), &r); err != nil {
+				t.Fatalf("invalid JSON output %q: %v", out.String(), err)
+			}
+			if len(r.Responses) != len(tt.wantMsgs) {
+				t.Fatalf("got %d responses, want %d", len(r.Responses), len(tt.wantMsgs))
+			}
+			for i, raw := range r.Responses {
+				var res struct{ Message string }
+				if err := json.Unmarshal(raw, &res); err != nil {
+					t.Fatal(err)
+				}
+				if res.Message != tt.wantMsgs[i] {
+					t.Errorf("response[%d] = %q, want %q", i, res.Message, tt.wantMsgs[i])
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, r)
+			}
+		})
+	}
+}
+
+func TestTraceFile(t *testing.T) {
+	dialer := newFakeServer(t).Dialer()
+	// run はhelloを実行し、結果がJSONとして読めることを確かめる
+	run := func(t *testing.T, traceFile string) *commonFlags {
+		t.Helper()
+		common := newCommonFlags()
+		var out bytes.Buffer
+		if err := runCommand(common, []string{"hello", "--name", "hsaki", "--metadata", "k=v", "--trace-file", traceFile}, &out, dialer); err != nil {
+			t.Fatal(err)
+		}
+		var r result
+		if err := json.Unmarshal(out.Bytes(), &r); err != nil {
+			t.Fatalf("invalid JSON output %q: %v", out.String(), err)
+		}
+		return common
+	}
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "spans.jsonl")
+		common := run(t, path)
+		if common.exporter != nil {
+			t.Error("exporter was not closed")
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b, []byte(`"/myapp.GreetingService/Hello"`)) {
+			t.Errorf("spans = %s, want the Hello span", b)
+		}
+	})
+
+	t.Run("stderr", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stderr := os.Stderr
+		os.Stderr = w
+		defer func() { os.Stderr = stderr }()
+
+		// "-"のスパンは結果のJSONと混ざらないように標準エラー出力に書かれる
+		run(t, "-")
+		w.Close()
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b, []byte(`"/myapp.GreetingService/Hello"`)) {
+			t.Errorf("stderr = %s, want the Hello span", b)
+		}
+	})
+}
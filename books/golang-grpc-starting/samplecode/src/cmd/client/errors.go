@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+func printStatus(stat *status.Status) {
+	fmt.Printf("code: %s\n", stat.Code())
+	fmt.Printf("message: %s\n", stat.Message())
+	for _, d := range stat.Details() {
+		fmt.Printf("details: %s\n", describeDetail(d))
+	}
+}
+
+// describeDetail はエラー詳細を型ごとに読みやすい文字列に変換する
+func describeDetail(detail interface{}) string {
+	switch d := detail.(type) {
+	case *errdetails.BadRequest:
+		violations := make([]string, 0, len(d.GetFieldViolations()))
+		for _, v := range d.GetFieldViolations() {
+			violations = append(violations, fmt.Sprintf("%s: %s", v.GetField(), v.GetDescription()))
+		}
+		return fmt.Sprintf("bad request (%s)", strings.Join(violations, "; "))
+	case *errdetails.RetryInfo:
+		return fmt.Sprintf("retry after %s", d.GetRetryDelay().AsDuration())
+	case *errdetails.DebugInfo:
+		if len(d.GetStackEntries()) == 0 {
+			return fmt.Sprintf("debug info: %s", d.GetDetail())
+		}
+		return fmt.Sprintf("debug info: %s\n%s", d.GetDetail(), strings.Join(d.GetStackEntries(), "\n"))
+	case error:
+		return fmt.Sprintf("undecodable detail: %v", d)
+	default:
+		return fmt.Sprintf("%v", d)
+	}
+}
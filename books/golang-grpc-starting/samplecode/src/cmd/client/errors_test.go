@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestDescribeDetail(t *testing.T) {
+	stat, err := status.New(codes.InvalidArgument, "invalid").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "name", Description: "name must not be empty"},
+		}},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(2 * time.Second)},
+		&errdetails.DebugInfo{Detail: "detail reason of err"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"bad request (name: name must not be empty)",
+		"retry after 2s",
+		"debug info: detail reason of err",
+	}
+	details := stat.Details()
+	if len(details) != len(want) {
+		t.Fatalf("got %d details, want %d", len(details), len(want))
+	}
+	for i, d := range details {
+		if got := describeDetail(d); got != want[i] {
+			t.Errorf("describeDetail(%T) = %q, want %q", d, got, want[i])
+		}
+	}
+}
@@ -4,29 +4,53 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/loadbalance"
 )
 
 var (
-	scanner *bufio.Scanner
-	client  hellopb.GreetingServiceClient
+	// lines は標準入力を1行ずつ渡す。標準入力を読むのはmainが起動するgoroutineだけにする
+	lines  <-chan string
+	client hellopb.GreetingServiceClient
 )
 
+// scanLines はrを1行ずつ読んで送るチャネルを返す。読み終わるとチャネルは閉じられる
+func scanLines(r io.Reader) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			ch <- scanner.Text()
+		}
+	}()
+	return ch
+}
+
+// readLine は入力を1行読む。入力が終わっていれば空文字列を返す
+func readLine() string {
+	return <-lines
+}
+
 func Hello() {
 	fmt.Println("Please enter your name.")
-	scanner.Scan()
-	name := scanner.Text()
+	name := readLine()
 
 	req := &hellopb.HelloRequest{
 		Name: name,
@@ -39,9 +63,7 @@ func Hello() {
 	res, err := client.Hello(ctx, req, grpc.Header(&header), grpc.Trailer(&trailer))
 	if err != nil {
 		if stat, ok := status.FromError(err); ok {
-			fmt.Printf("code: %s\n", stat.Code())
-			fmt.Printf("message: %s\n", stat.Message())
-			fmt.Printf("details: %s\n", stat.Details())
+			printStatus(stat)
 		} else {
 			fmt.Println(err)
 		}
@@ -54,12 +76,32 @@ func Hello() {
 
 func HelloServerStream() {
 	fmt.Println("Please enter your name.")
-	scanner.Scan()
-	name := scanner.Text()
+	name := readLine()
 
 	req := &hellopb.HelloRequest{
 		Name: name,
 	}
+
+	fmt.Println("Please enter the number of responses. (empty for the server default)")
+	if in := strings.TrimSpace(readLine()); in != "" {
+		count, err := strconv.Atoi(in)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		req.Count = proto.Int32(int32(count))
+	}
+
+	fmt.Println("Please enter the interval of responses, e.g. 500ms. (empty for the server default)")
+	if in := strings.TrimSpace(readLine()); in != "" {
+		interval, err := time.ParseDuration(in)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		req.Interval = durationpb.New(interval)
+	}
+
 	stream, err := client.HelloServerStream(context.Background(), req)
 	if err != nil {
 		fmt.Println(err)
@@ -73,7 +115,12 @@ func HelloServerStream() {
 			break
 		}
 		if err != nil {
-			fmt.Println(err)
+			if stat, ok := status.FromError(err); ok {
+				printStatus(stat)
+			} else {
+				fmt.Println(err)
+			}
+			break
 		}
 		fmt.Println(res)
 	}
@@ -89,8 +136,7 @@ func HelloClientStream() {
 	sendCount := 5
 	fmt.Printf("Please enter %d names.\n", sendCount)
 	for i := 0; i < sendCount; i++ {
-		scanner.Scan()
-		name := scanner.Text()
+		name := readLine()
 
 		if err := stream.Send(&hellopb.HelloRequest{
 			Name: name,
@@ -113,59 +159,34 @@ func HelloBiStreams() {
 	md := metadata.New(map[string]string{"type": "stream", "from": "client"})
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
+	sendNum := 5
+	fmt.Printf("Please enter %d names.\n", sendNum)
+
+	ctx, cancel := context.WithCancel(ctx)
 	stream, err := client.HelloBiStreams(ctx)
 	if err != nil {
+		cancel()
 		fmt.Println(err)
 		return
 	}
 
-	sendNum := 5
-	fmt.Printf("Please enter %d names.\n", sendNum)
-
-	var sendEnd, recvEnd bool
-	sendCount := 0
-	for !(sendEnd && recvEnd) {
-		// 送信処理
-		if !sendEnd {
-			scanner.Scan()
-			name := scanner.Text()
-
-			sendCount++
-			if err := stream.Send(&hellopb.HelloRequest{
-				Name: name,
-			}); err != nil {
-				fmt.Println(err)
-				sendEnd = true
-			}
-
-			if sendCount == sendNum {
-				sendEnd = true
-				if err := stream.CloseSend(); err != nil {
-					fmt.Println(err)
-				}
-			}
-		}
-
-		// 受信処理
-		var headerMD metadata.MD
-		if !recvEnd {
-			if headerMD == nil {
-				headerMD, err = stream.Header()
-				if err != nil {
-					fmt.Println(err)
-				} else {
-					fmt.Println(headerMD)
-				}
-			}
-
-			if res, err := stream.Recv(); err != nil {
-				if !errors.Is(err, io.EOF) {
-					fmt.Println(err)
-				}
-				recvEnd = true
-			} else {
-				fmt.Println(res.GetMessage())
+	var printHeader sync.Once
+	// 入力を待っている間も応答を表示できるように、送信と受信は別のgoroutineで行う
+	// 途中で受信が失敗しても、残りの入力はlinesに残ってメニューで読まれる
+	err = runBidi(ctx, cancel, stream, 0, chanNames(lines, sendNum), func(res *hellopb.HelloResponse) error {
+		printHeader.Do(func() {
+			if headerMD, err := stream.Header(); err == nil {
+				fmt.Println(headerMD)
 			}
+		})
+		fmt.Println(res.GetMessage())
+		return nil
+	})
+	if err != nil {
+		if stat, ok := status.FromError(err); ok {
+			printStatus(stat)
+		} else {
+			fmt.Println(err)
 		}
 	}
 
@@ -173,13 +194,8 @@ func HelloBiStreams() {
 	fmt.Println(trailerMD)
 }
 
-func main() {
-	fmt.Println("start gRPC Client.")
-	scanner = bufio.NewScanner(os.Stdin)
-
-	address := "localhost:8080"
-	conn, err := grpc.Dial(
-		address,
+func dial(ctx context.Context, address string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
 		grpc.WithChainUnaryInterceptor(
 			myUnaryClientInteceptor1,
 			myUnaryClientInteceptor2,
@@ -188,10 +204,40 @@ func main() {
 			myStreamClientInteceptor1,
 			myStreamClientInteceptor2,
 		),
-
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithBlock(),
-	)
+	}, opts...)
+	return grpc.DialContext(ctx, loadbalance.Target(address), opts...)
+}
+
+func main() {
+	common := newCommonFlags()
+	common.register(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// サブコマンドが指定された場合は非対話モードで実行する
+	if flag.NArg() > 0 {
+		if err := runCommand(common, flag.Args(), os.Stdout); err != nil {
+			if !errors.Is(err, errRPCFailed) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Println("start gRPC Client.")
+	lines = scanLines(os.Stdin)
+
+	opts, err := common.dialOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer common.closeTracer()
+	conn, err := dial(context.Background(), common.addr, opts...)
 	if err != nil {
 		log.Fatal("Connection failed.")
 		return
@@ -208,8 +254,7 @@ func main() {
 		fmt.Println("5: exit")
 		fmt.Print("please enter >")
 
-		scanner.Scan()
-		in := scanner.Text()
+		in := readLine()
 
 		switch in {
 		case "1":
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const reflectUsage = `usage: client reflect [flags] <command>
+
+commands:
+  list                               list services and their methods
+  describe SYMBOL                    describe a service, method, message or enum
+  invoke [--data JSON] METHOD        call a unary method, e.g. myapp.GreetingService/Hello
+`
+
+// reflectionClient はサーバーリフレクションで受け取ったディスクリプタを組み立てる
+type reflectionClient struct {
+	stream rpb.ServerReflection_ServerReflectionInfoClient
+	files  *protoregistry.Files
+	// pending は受け取ったがまだ依存先が揃っていないファイル
+	pending map[string]*descriptorpb.FileDescriptorProto
+}
+
+func newReflectionClient(ctx context.Context, conn grpc.ClientConnInterface) (*reflectionClient, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &reflectionClient{
+		stream:  stream,
+		files:   new(protoregistry.Files),
+		pending: make(map[string]*descriptorpb.FileDescriptorProto),
+	}, nil
+}
+
+func (c *reflectionClient) close() {
+	c.stream.CloseSend()
+}
+
+func (c *reflectionClient) call(req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := c.stream.Send(req); err != nil {
+		return nil, err
+	}
+	res, err := c.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if e := res.GetErrorResponse(); e != nil {
+		return nil, fmt.Errorf("reflection: %s (code %d)", e.GetErrorMessage(), e.GetErrorCode())
+	}
+	return res, nil
+}
+
+// listServices はサーバーに登録されているサービス名を返す
+func (c *reflectionClient) listServices() ([]string, error) {
+	res, err := c.call(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, s := range res.GetListServicesResponse().GetService() {
+		names = append(names, s.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// resolve はnameのディスクリプタを返す
+// 手元にない場合は、nameを含むファイルとその依存先をサーバーから取得する
+func (c *reflectionClient) resolve(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := c.files.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	res, err := c.call(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: string(name)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	files, err := c.addFiles(res)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if err := c.build(f); err != nil {
+			return nil, err
+		}
+	}
+	return c.files.FindDescriptorByName(name)
+}
+
+// addFiles はレスポンスに含まれるファイルをpendingに加え、その名前を返す
+func (c *reflectionClient) addFiles(res *rpb.ServerReflectionResponse) ([]string, error) {
+	var names []string
+	for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal(b, fd); err != nil {
+			return nil, err
+		}
+		c.pending[fd.GetName()] = fd
+		names = append(names, fd.GetName())
+	}
+	return names, nil
+}
+
+// build は依存先から順にファイルを組み立ててfilesに登録する
+// サーバーは同じストリームで送信済みのファイルを再送しないので、足りない依存先だけを取得する
+func (c *reflectionClient) build(name string) error {
+	if _, err := c.files.FindFileByPath(name); err == nil {
+		return nil
+	}
+	fd, ok := c.pending[name]
+	if !ok {
+		res, err := c.call(&rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := c.addFiles(res); err != nil {
+			return err
+		}
+		if fd, ok = c.pending[name]; !ok {
+			return fmt.Errorf("reflection: server did not return %s", name)
+		}
+	}
+	for _, dep := range fd.GetDependency() {
+		if err := c.build(dep); err != nil {
+			return err
+		}
+	}
+	f, err := protodesc.NewFile(fd, c.files)
+	if err != nil {
+		return err
+	}
+	delete(c.pending, name)
+	return c.files.RegisterFile(f)
+}
+
+// resolveMethod は"pkg.Service/Method"か"pkg.Service.Method"の形式でメソッドを探す
+func (c *reflectionClient) resolveMethod(name string) (protoreflect.MethodDescriptor, error) {
+	name = strings.TrimPrefix(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[:i] + "." + name[i+1:]
+	}
+	d, err := c.resolve(protoreflect.FullName(name))
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+	return md, nil
+}
+
+// serviceList はlistの出力
+type serviceList struct {
+	Services []serviceEntry `json:"services"`
+}
+
+type serviceEntry struct {
+	Name    string   `json:"name"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+func (c *reflectionClient) list() (*serviceList, error) {
+	names, err := c.listServices()
+	if err != nil {
+		return nil, err
+	}
+	out := &serviceList{Services: []serviceEntry{}}
+	for _, name := range names {
+		d, err := c.resolve(protoreflect.FullName(name))
+		if err != nil {
+			return nil, err
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", name)
+		}
+		entry := serviceEntry{Name: name}
+		for i := 0; i < sd.Methods().Len(); i++ {
+			entry.Methods = append(entry.Methods, methodPath(sd.Methods().Get(i)))
+		}
+		out.Services = append(out.Services, entry)
+	}
+	return out, nil
+}
+
+// methodPath はgRPCの呼び出しで使う"/pkg.Service/Method"の形式の名前を返す
+func methodPath(md protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+}
+
+// description はdescribeの出力
+// ディスクリプタはdescriptor.protoのメッセージをJSONにしたもの
+type description struct {
+	Kind       string          `json:"kind"`
+	Name       string          `json:"name"`
+	File       string          `json:"file"`
+	Descriptor json.RawMessage `json:"descriptor"`
+}
+
+func (c *reflectionClient) describe(symbol string) (*description, error) {
+	d, err := c.resolve(protoreflect.FullName(symbol))
+	if err != nil {
+		return nil, err
+	}
+
+	var kind string
+	var m proto.Message
+	switch d := d.(type) {
+	case protoreflect.ServiceDescriptor:
+		kind, m = "service", protodesc.ToServiceDescriptorProto(d)
+	case protoreflect.MethodDescriptor:
+		kind, m = "method", protodesc.ToMethodDescriptorProto(d)
+	case protoreflect.MessageDescriptor:
+		kind, m = "message", protodesc.ToDescriptorProto(d)
+	case protoreflect.EnumDescriptor:
+		kind, m = "enum", protodesc.ToEnumDescriptorProto(d)
+	case protoreflect.FieldDescriptor:
+		kind, m = "field", protodesc.ToFieldDescriptorProto(d)
+	case protoreflect.EnumValueDescriptor:
+		kind, m = "enum value", protodesc.ToEnumValueDescriptorProto(d)
+	default:
+		return nil, fmt.Errorf("cannot describe %s", symbol)
+	}
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return &description{
+		Kind:       kind,
+		Name:       string(d.FullName()),
+		File:       d.ParentFile().Path(),
+		Descriptor: b,
+	}, nil
+}
+
+// invoke はJSONのリクエストでunaryメソッドを呼び出し、結果をrに書き込む
+func (c *reflectionClient) invoke(ctx context.Context, conn grpc.ClientConnInterface, method, data string, r *result) error {
+	md, err := c.resolveMethod(method)
+	if err != nil {
+		return err
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return fmt.Errorf("%s is a streaming method; only unary methods can be invoked", md.FullName())
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal([]byte(data), req); err != nil {
+		return fmt.Errorf("request of %s: %w", md.FullName(), err)
+	}
+	res := dynamicpb.NewMessage(md.Output())
+	if err := conn.Invoke(ctx, methodPath(md), req, res, grpc.Header(&r.Header), grpc.Trailer(&r.Trailer)); err != nil {
+		return &rpcError{err: err}
+	}
+	return r.addMessage(res)
+}
+
+// rpcError はリフレクションではなく呼び出したRPCが失敗したことを表す
+type rpcError struct {
+	err error
+}
+
+func (e *rpcError) Error() string { return e.err.Error() }
+func (e *rpcError) Unwrap() error { return e.err }
+
+// runReflect はreflectサブコマンドを実行し、結果をJSONでwに書き出す
+func runReflect(common *commonFlags, args []string, w io.Writer, dialOpts ...grpc.DialOption) error {
+	fs := flag.NewFlagSet("reflect", flag.ContinueOnError)
+	common.register(fs)
+	data := fs.String("data", "{}", "JSON request body of invoke")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), reflectUsage)
+		fs.PrintDefaults()
+	}
+	// サブコマンドや引数の後ろに書いたフラグも受け付ける
+	var pos []string
+	for rest := args; ; {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+	if len(pos) == 0 {
+		return fmt.Errorf("reflect needs a command\n%s", reflectUsage)
+	}
+	cmd, pos := pos[0], pos[1:]
+	var want int
+	switch cmd {
+	case "list":
+	case "describe", "invoke":
+		want = 1
+	default:
+		return fmt.Errorf("unknown reflect command %q\n%s", cmd, reflectUsage)
+	}
+	if len(pos) != want {
+		return fmt.Errorf("%s takes %d argument(s)\n%s", cmd, want, reflectUsage)
+	}
+
+	ctx, cancel := common.rpcContext()
+	defer cancel()
+	conn, err := common.connect(ctx, dialOpts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx = metadata.NewOutgoingContext(ctx, common.metadata.md())
+
+	rc, err := newReflectionClient(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer rc.close()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	switch cmd {
+	case "list":
+		out, err := rc.list()
+		if err != nil {
+			return err
+		}
+		return enc.Encode(out)
+	case "describe":
+		out, err := rc.describe(pos[0])
+		if err != nil {
+			return err
+		}
+		return enc.Encode(out)
+	}
+
+	// invokeはほかのサブコマンドと同じ形式で結果を出力する
+	r := &result{Responses: []json.RawMessage{}}
+	err = rc.invoke(ctx, conn, pos[0], *data, r)
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		r.setError(rpcErr.err)
+	} else if err != nil {
+		return err
+	}
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	if rpcErr != nil {
+		return errRPCFailed
+	}
+	return nil
+}
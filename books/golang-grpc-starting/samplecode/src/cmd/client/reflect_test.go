@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// サーバーのインターセプターチェーン(認証やレート制限)を通した確認は、cmd/serverのTestReflectionで行う
+func TestRunReflect(t *testing.T) {
+	dialer := newFakeServer(t).Dialer()
+	run := func(t *testing.T, args ...string) ([]byte, error) {
+		t.Helper()
+		var out bytes.Buffer
+		err := runCommand(newCommonFlags(), append([]string{"reflect"}, args...), &out, dialer)
+		return out.Bytes(), err
+	}
+
+	t.Run("list", func(t *testing.T) {
+		out, err := run(t, "list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got serviceList
+		if err := json.Unmarshal(out, &got); err != nil {
+			t.Fatalf("invalid JSON output %q: %v", out, err)
+		}
+		var greeting *serviceEntry
+		for i, s := range got.Services {
+			if s.Name == "myapp.GreetingService" {
+				greeting = &got.Services[i]
+			}
+		}
+		if greeting == nil {
+			t.Fatalf("services = %+v, want myapp.GreetingService", got.Services)
+		}
+		want := []string{
+			"/myapp.GreetingService/Hello",
+			"/myapp.GreetingService/HelloServerStream",
+			"/myapp.GreetingService/HelloClientStream",
+			"/myapp.GreetingService/HelloBiStreams",
+		}
+		if strings.Join(greeting.Methods, ",") != strings.Join(want, ",") {
+			t.Errorf("methods = %v, want %v", greeting.Methods, want)
+		}
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		tests := []struct {
+			symbol string
+			kind   string
+			// want はディスクリプタのJSONに含まれるはずの文字列
+			want string
+		}{
+			{symbol: "myapp.GreetingService", kind: "service", want: `"name":"HelloBiStreams"`},
+			{symbol: "myapp.GreetingService.Hello", kind: "method", want: `"inputType":".myapp.HelloRequest"`},
+			// 依存先のファイル(duration.proto)の型も解決できる
+			{symbol: "myapp.HelloRequest", kind: "message", want: `"typeName":".google.protobuf.Duration"`},
+		}
+		for _, tt := range tests {
+			out, err := run(t, "describe", tt.symbol)
+			if err != nil {
+				t.Fatalf("describe %s: %v", tt.symbol, err)
+			}
+			var got description
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("invalid JSON output %q: %v", out, err)
+			}
+			if got.Kind != tt.kind || got.Name != tt.symbol || got.File != "hello.proto" {
+				t.Errorf("describe %s = %s %s in %s", tt.symbol, got.Kind, got.Name, got.File)
+			}
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, got.Descriptor); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(compact.String(), tt.want) {
+				t.Errorf("describe %s = %s, want %s in it", tt.symbol, compact.String(), tt.want)
+			}
+		}
+
+		if _, err := run(t, "describe", "myapp.NoSuchMessage"); err == nil {
+			t.Error("describe of an unknown symbol succeeded")
+		}
+	})
+
+	t.Run("invoke", func(t *testing.T) {
+		// フラグはメソッド名の後ろに書いてもよい
+		out, err := run(t, "invoke", "myapp.GreetingService/Hello", "--data", `{"name": "hsaki"}`, "--metadata", "k=v")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r result
+		if err := json.Unmarshal(out, &r); err != nil {
+			t.Fatalf("invalid JSON output %q: %v", out, err)
+		}
+		if len(r.Responses) != 1 {
+			t.Fatalf("got %d responses, want 1", len(r.Responses))
+		}
+		var res struct{ Message string }
+		if err := json.Unmarshal(r.Responses[0], &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Message != "Hello, hsaki!" {
+			t.Errorf("message = %q", res.Message)
+		}
+		if got := r.Header.Get("echo"); len(got) != 1 || got[0] != "v" {
+			t.Errorf("header echo = %v, want [v]", got)
+		}
+
+		// RPCのエラーはほかのサブコマンドと同じくJSONで出力される
+		out, err = run(t, "invoke", "--metadata", "k=v", "/myapp.GreetingService/Hello")
+		if !errors.Is(err, errRPCFailed) {
+			t.Fatalf("invoke with an empty name: %v, want errRPCFailed", err)
+		}
+		r = result{}
+		if err := json.Unmarshal(out, &r); err != nil {
+			t.Fatalf("invalid JSON output %q: %v", out, err)
+		}
+		if r.Error == nil || r.Error.Code != "InvalidArgument" {
+			t.Errorf("error = %+v, want InvalidArgument", r.Error)
+		}
+
+		for _, args := range [][]string{
+			{"invoke", "myapp.GreetingService/HelloServerStream"},
+			{"invoke", "myapp.GreetingService/Hello", "--data", `{"nickname": "x"}`},
+			{"invoke", "myapp.HelloRequest"},
+		} {
+			if _, err := run(t, args...); err == nil || errors.Is(err, errRPCFailed) {
+				t.Errorf("%v: error = %v, want a usage error", args, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,101 @@
+// Command deploygen renders the Dockerfile, the Kubernetes manifests and the
+// ECS container definition from the server config, so that the ports and the
+// health checks in them always match what the server reads.
+//
+//	go run ./cmd/deploygen -config cmd/server/server.yaml -out ..
+//
+// It takes the same -config, flags and MYGRPC_* environment variables as the
+// server.
+package main
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"mygrpc/pkg/serverconfig"
+)
+
+//go:embed templates
+var templates embed.FS
+
+const templateSuffix = ".tmpl"
+
+type envVar struct {
+	Name, Value string
+}
+
+// data はテンプレートに渡す値
+type data struct {
+	Config        serverconfig.Config
+	HealthService string
+	Env           []envVar
+}
+
+func newData(conf serverconfig.Config) data {
+	d := data{Config: conf, HealthService: serverconfig.HealthService}
+	for _, kv := range conf.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		d.Env = append(d.Env, envVar{Name: name, Value: value})
+	}
+	return d
+}
+
+// render はすべてのテンプレートを展開し、出力先の相対パスと内容を返す
+func render(conf serverconfig.Config) (map[string][]byte, error) {
+	d := newData(conf)
+	out := make(map[string][]byte)
+	err := fs.WalkDir(templates, "templates", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		b, err := templates.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// k8sのマニフェストはHelmのテンプレートでもあり{{ }}を含むので、区切り文字を変える
+		tmpl, err := template.New(path).Delims("[[", "]]").Option("missingkey=error").Parse(string(b))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, d); err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "templates/"), templateSuffix)
+		out[name] = buf.Bytes()
+		return nil
+	})
+	return out, err
+}
+
+func main() {
+	outDir := flag.String("out", ".", "directory the files are written to (the samplecode directory)")
+	loader := serverconfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	conf, err := loader.Load(os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	files, err := render(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, b := range files {
+		path := filepath.Join(*outDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("wrote %s", path)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"mygrpc/pkg/serverconfig"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestRender(t *testing.T) {
+	conf, err := serverconfig.LoadFile(filepath.Join("testdata", "server.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := render(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"Dockerfile", "ecs/server.tf", "k8s/deployment.yaml", "k8s/ingress.yaml", "k8s/service.yaml"}
+	if len(names) != len(want) {
+		t.Fatalf("rendered %v, want %v", names, want)
+	}
+
+	for i, name := range names {
+		if name != want[i] {
+			t.Fatalf("rendered %v, want %v", names, want)
+		}
+		golden := filepath.Join("testdata", "golden", filepath.FromSlash(name)+".golden")
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(golden, files[name], 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		b, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(files[name], b) {
+			t.Errorf("%s differs from %s (run go test -update to accept)\n%s", name, golden, files[name])
+		}
+	}
+}
+
+// TestCheckedIn はリポジトリにあるファイルがサーバーの設定から生成し直されているかを確かめる
+func TestCheckedIn(t *testing.T) {
+	conf, err := serverconfig.LoadFile(filepath.Join("..", "server", "server.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := render(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		path := filepath.Join("..", "..", "..", filepath.FromSlash(name))
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date; run make manifests", path)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log/slog"
+
+	"google.golang.org/grpc"
+
+	"mygrpc/pkg/gateway"
+	"mygrpc/pkg/interceptor/auth"
+	"mygrpc/pkg/interceptor/logging"
+	"mygrpc/pkg/interceptor/ratelimit"
+	"mygrpc/pkg/interceptor/recovery"
+	"mygrpc/pkg/metrics"
+	"mygrpc/pkg/tracing"
+)
+
+// chain はサーバーのインターセプターチェーンを組み立てるための部品
+// mainとテストで同じ順序のチェーンを使うためにまとめている
+type chain struct {
+	tracer   *tracing.Tracer
+	metrics  *metrics.ServerMetrics
+	logger   *slog.Logger
+	recovery []recovery.Option
+	// tokens がnilなら認証しない
+	tokens auth.TokenVerifier
+	// limiter がnilならレート制限しない
+	limiter *ratelimit.Limiter
+}
+
+// serverOptions はチェーンを設定するgrpc.ServerOptionを返す
+func (c *chain) serverOptions() []grpc.ServerOption {
+	// tracingは一番外側に置き、内側のログやリカバリーがリクエストIDを使えるようにする
+	// recoveryはメトリクスとログの内側に置き、panicもInternalとして記録されるようにする
+	// 呼び出し元の識別に使うメタデータは、呼び出し元が送ってきても使わない
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		gateway.StripUnaryServerInterceptor(),
+		c.tracer.UnaryServerInterceptor(),
+		c.metrics.UnaryServerInterceptor(),
+		logging.UnaryServerInterceptor(logging.WithLogger(c.logger)),
+		recovery.UnaryServerInterceptor(c.recovery...),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		gateway.StripStreamServerInterceptor(),
+		c.tracer.StreamServerInterceptor(),
+		c.metrics.StreamServerInterceptor(),
+		logging.StreamServerInterceptor(logging.WithLogger(c.logger)),
+		recovery.StreamServerInterceptor(c.recovery...),
+	}
+	if c.tokens != nil {
+		// ヘルスチェックとリフレクションは認証なしで呼べるようにしておく
+		public := auth.WithPublicMethods(
+			"/grpc.health.v1.Health/",
+			"/grpc.reflection.v1alpha.ServerReflection/",
+		)
+		unaryInterceptors = append(unaryInterceptors, auth.UnaryServerInterceptor(c.tokens, public))
+		streamInterceptors = append(streamInterceptors, auth.StreamServerInterceptor(c.tokens, public))
+	}
+	if c.limiter != nil {
+		// 認証の後に置くことで、呼び出し元ごとの制限にプリンシパルが使われる
+		unaryInterceptors = append(unaryInterceptors, c.limiter.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, c.limiter.StreamServerInterceptor())
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+		grpc.StatsHandler(c.metrics),
+	}
+}
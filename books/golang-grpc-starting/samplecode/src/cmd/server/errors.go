@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	hellopb "mygrpc/pkg/grpc"
+)
+
+const maxNameLength = 64
+
+// HelloServerStreamのレスポンス数と送信間隔のデフォルト値と上限
+const (
+	defaultStreamCount    = 5
+	maxStreamCount        = 100
+	defaultStreamInterval = time.Second
+	maxStreamInterval     = 10 * time.Second
+)
+
+func validateHelloRequest(req *hellopb.HelloRequest) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+
+	name := req.GetName()
+	switch {
+	case name == "":
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "name",
+			Description: "name must not be empty",
+		})
+	case utf8.RuneCountInString(name) > maxNameLength:
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "name",
+			Description: fmt.Sprintf("name must be at most %d characters", maxNameLength),
+		})
+	}
+
+	return badRequest(violations)
+}
+
+// streamParams はHelloServerStreamのレスポンス数と送信間隔を、デフォルト値を補って返す
+func streamParams(req *hellopb.HelloRequest) (count int, interval time.Duration, err error) {
+	var violations []*errdetails.BadRequest_FieldViolation
+
+	count = defaultStreamCount
+	if req.Count != nil {
+		count = int(req.GetCount())
+		if count < 1 || count > maxStreamCount {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       "count",
+				Description: fmt.Sprintf("count must be between 1 and %d", maxStreamCount),
+			})
+		}
+	}
+
+	interval = defaultStreamInterval
+	if req.Interval != nil {
+		interval = req.GetInterval().AsDuration()
+		if err := req.GetInterval().CheckValid(); err != nil || interval < 0 || interval > maxStreamInterval {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       "interval",
+				Description: fmt.Sprintf("interval must be between 0s and %s", maxStreamInterval),
+			})
+		}
+	}
+
+	return count, interval, badRequest(violations)
+}
+
+func badRequest(violations []*errdetails.BadRequest_FieldViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	stat := status.New(codes.InvalidArgument, "invalid HelloRequest")
+	if withDetails, err := stat.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		stat = withDetails
+	}
+	return stat.Err()
+}
+
+func resourceExhaustedError(retryDelay time.Duration) error {
+	stat := status.New(codes.ResourceExhausted, "server is overloaded")
+	if withDetails, err := stat.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}); err == nil {
+		stat = withDetails
+	}
+	return stat.Err()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"mygrpc/pkg/gateway"
+	hellopb "mygrpc/pkg/grpc"
+)
+
+// newGatewayHandler はHTTP/JSONのリクエストをGreetingServiceの呼び出しに変換するハンドラを作る
+// ゲートウェイはプロセス内のgRPCサーバーを呼ぶので、外向きのポートのTLS設定に影響されない
+// 呼び出しはoptsのインターセプターを通るので、認証やレート制限は通常のgRPCと同じように効く
+// その前にピアをHTTPクライアントのアドレスに置き換え、レート制限やログがHTTPクライアントごとになるようにする
+func newGatewayHandler(greeting hellopb.GreetingServiceServer, opts ...grpc.ServerOption) (*gateway.Gateway, *grpc.Server, error) {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(gateway.PeerUnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(gateway.PeerStreamServerInterceptor()),
+	}, opts...)...)
+	hellopb.RegisterGreetingServiceServer(s, greeting)
+	go s.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.Stop()
+		return nil, nil, err
+	}
+
+	gw, err := gateway.New(conn, hellopb.File_hello_proto.Services().ByName("GreetingService"))
+	if err != nil {
+		conn.Close()
+		s.Stop()
+		return nil, nil, err
+	}
+	return gw, s, nil
+}
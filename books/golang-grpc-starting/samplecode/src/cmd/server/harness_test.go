@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	"mygrpc/internal/grpctest"
+	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/interceptor/recovery"
+	"mygrpc/pkg/metrics"
+	"mygrpc/pkg/tracing"
+)
+
+// harness はmainと同じインターセプターチェーンでmyServerをbufconn上に立てる
+type harness struct {
+	client hellopb.GreetingServiceClient
+	// conn はGreetingService以外のサービス(リフレクションなど)を呼ぶための接続
+	conn *grpc.ClientConn
+	// logs はインターセプターが書いたログ
+	logs     *bytes.Buffer
+	registry *metrics.Registry
+
+	handlerDone chan error
+}
+
+type harnessConfig struct {
+	srv   *myServer
+	chain func(*chain)
+}
+
+type harnessOption func(*harnessConfig)
+
+// withServer は立てるmyServerを差し替える
+func withServer(srv *myServer) harnessOption {
+	return func(c *harnessConfig) {
+		c.srv = srv
+	}
+}
+
+// withChain はチェーンの設定(認証やレート制限など)を変更する
+func withChain(f func(*chain)) harnessOption {
+	return func(c *harnessConfig) {
+		c.chain = f
+	}
+}
+
+func newHarness(t *testing.T, opts ...harnessOption) *harness {
+	t.Helper()
+
+	conf := &harnessConfig{srv: NewMyServer()}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	h := &harness{
+		logs:        &bytes.Buffer{},
+		registry:    metrics.NewRegistry(),
+		handlerDone: make(chan error, 16),
+	}
+	logger := slog.New(tracing.NewLogHandler(slog.NewJSONHandler(h.logs, nil)))
+	c := &chain{
+		tracer:   tracing.NewTracer(nil),
+		metrics:  metrics.NewServerMetrics(h.registry),
+		logger:   logger,
+		recovery: []recovery.Option{recovery.WithLogger(logger)},
+	}
+	if conf.chain != nil {
+		conf.chain(c)
+	}
+
+	// チェーンの一番内側でストリームハンドラの戻り値を記録する
+	record := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		h.handlerDone <- err
+		return err
+	}
+	serverOpts := append(c.serverOptions(), grpc.ChainStreamInterceptor(record))
+
+	srv := grpctest.NewServer(t, func(s *grpc.Server) {
+		hellopb.RegisterGreetingServiceServer(s, conf.srv)
+		reflection.Register(s)
+	}, serverOpts...)
+
+	h.conn = srv.Dial(t)
+	h.client = hellopb.NewGreetingServiceClient(h.conn)
+	return h
+}
+
+// waitHandler はサーバー側のストリームハンドラが終わるのを待ち、その戻り値を返す
+func (h *harness) waitHandler(t *testing.T, timeout time.Duration) error {
+	t.Helper()
+	select {
+	case err := <-h.handlerDone:
+		return err
+	case <-time.After(timeout):
+		t.Fatalf("stream handler did not return within %s", timeout)
+		return nil
+	}
+}
+
+// messages はレスポンスのメッセージ部分だけを取り出す
+func messages(res []*hellopb.HelloResponse) []string {
+	out := make([]string, 0, len(res))
+	for _, r := range res {
+		out = append(out, r.GetMessage())
+	}
+	return out
+}
+
+// receivedMessages はメトリクスからmethodでサーバーが受け取ったメッセージ数を読む
+func (h *harness) receivedMessages(t *testing.T, method string) int64 {
+	t.Helper()
+	var b strings.Builder
+	if err := h.registry.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	prefix := "grpc_server_msg_received_total{"
+	for _, line := range strings.Split(b.String(), "\n") {
+		if !strings.HasPrefix(line, prefix) || !strings.Contains(line, fmt.Sprintf("grpc_method=%q", method)) {
+			continue
+		}
+		n, err := strconv.ParseFloat(line[strings.LastIndex(line, " ")+1:], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int64(n)
+	}
+	return 0
+}
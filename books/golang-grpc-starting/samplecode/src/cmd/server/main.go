@@ -2,39 +2,62 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
-	// "google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
-	// "google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 
-	// "google.golang.org/grpc/status"
-
+	"mygrpc/pkg/connmux"
 	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/healthcheck"
+	"mygrpc/pkg/interceptor/auth"
+	"mygrpc/pkg/interceptor/ratelimit"
+	"mygrpc/pkg/interceptor/recovery"
+	"mygrpc/pkg/metrics"
+	"mygrpc/pkg/serverconfig"
+	"mygrpc/pkg/tlsutil"
+	"mygrpc/pkg/tracing"
 )
 
+// HelloBiStreamsで受信済み・未送信のまま保持するメッセージ数のデフォルト値
+const defaultBiStreamQueueSize = 16
+
 type myServer struct {
 	hellopb.UnimplementedGreetingServiceServer
+
+	// overloaded がtrueを返す間は過負荷状態をシミュレートし、HelloはRetryInfo付きのResourceExhaustedを返す
+	// mainでは-overload-ratioで設定する
+	overloaded func() bool
+	// biStreamQueueSize はHelloBiStreamsで受信済み・未送信のまま保持するメッセージ数の上限
+	biStreamQueueSize int
 }
 
 func (s *myServer) Hello(ctx context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
-	// (何か処理をしてエラーが発生した)
-	// stat := status.New(codes.Unknown, "unknown error occurred")
-	// stat, _ = stat.WithDetails(&errdetails.DebugInfo{
-	// 	Detail: "detail reason of err",
-	// })
-	// err := stat.Err()
+	if s.overloaded != nil && s.overloaded() {
+		return nil, resourceExhaustedError(time.Second)
+	}
+	if err := validateHelloRequest(req); err != nil {
+		return nil, err
+	}
+
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
 		log.Println(md)
 	}
@@ -52,18 +75,33 @@ func (s *myServer) Hello(ctx context.Context, req *hellopb.HelloRequest) (*hello
 	return &hellopb.HelloResponse{
 		Message: fmt.Sprintf("Hello, %s!", req.GetName()),
 	}, nil
-	// return nil, err
 }
 
 func (s *myServer) HelloServerStream(req *hellopb.HelloRequest, stream hellopb.GreetingService_HelloServerStreamServer) error {
-	resCount := 5
+	resCount, interval, err := streamParams(req)
+	if err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
 	for i := 0; i < resCount; i++ {
 		if err := stream.Send(&hellopb.HelloResponse{
 			Message: fmt.Sprintf("[%d] Hello, %s!", i, req.GetName()),
 		}); err != nil {
 			return err
 		}
-		time.Sleep(time.Second * 1)
+		if i == resCount-1 {
+			break
+		}
+
+		// クライアントがキャンセルした、もしくはデッドラインを過ぎたらすぐに終了する
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
 	}
 	return nil
 }
@@ -98,14 +136,34 @@ func (s *myServer) HelloBiStreams(stream hellopb.GreetingService_HelloBiStreamsS
 	trailerMD := metadata.New(map[string]string{"type": "stream", "from": "server", "in": "trailer"})
 	stream.SetTrailer(trailerMD)
 
-	for {
-		req, err := stream.Recv()
-		if errors.Is(err, io.EOF) {
-			return nil
-		}
-		if err != nil {
-			return err
+	// 受信と送信を分け、間を上限付きのキューでつなぐ
+	// クライアントが応答を読まずに送信だけを続けても、キューがいっぱいになると受信が止まり、
+	// HTTP/2のフロー制御でクライアントの送信も待たされるので、サーバーのメモリは増え続けない
+	ctx := stream.Context()
+	queue := make(chan *hellopb.HelloRequest, s.queueSize())
+	recvErr := make(chan error, 1)
+	go func() {
+		defer close(queue)
+		for {
+			req, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				recvErr <- nil
+				return
+			}
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case queue <- req:
+			case <-ctx.Done():
+				recvErr <- status.FromContextError(ctx.Err()).Err()
+				return
+			}
 		}
+	}()
+
+	for req := range queue {
 		message := fmt.Sprintf("Hello, %v!", req.GetName())
 		if err := stream.Send(&hellopb.HelloResponse{
 			Message: message,
@@ -113,6 +171,14 @@ func (s *myServer) HelloBiStreams(stream hellopb.GreetingService_HelloBiStreamsS
 			return err
 		}
 	}
+	return <-recvErr
+}
+
+func (s *myServer) queueSize() int {
+	if s.biStreamQueueSize > 0 {
+		return s.biStreamQueueSize
+	}
+	return defaultBiStreamQueueSize
 }
 
 func NewMyServer() *myServer {
@@ -120,39 +186,173 @@ func NewMyServer() *myServer {
 }
 
 func main() {
-	port := 8080
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	var tlsConf tlsutil.ServerConfig
+	flag.StringVar(&tlsConf.CertFile, "tls-cert", "", "server certificate file (enables TLS)")
+	flag.StringVar(&tlsConf.KeyFile, "tls-key", "", "server private key file")
+	flag.StringVar(&tlsConf.ClientCAFile, "tls-client-ca", "", "CA file to verify client certificates (enables mTLS)")
+	tokensFile := flag.String("auth-tokens", "", `file of "<token> <subject>" lines (enables bearer token authentication)`)
+	limitsFile := flag.String("ratelimit-config", "", "JSON file of per-method rate and concurrency limits")
+	debugErrors := flag.Bool("debug-errors", false, "attach stack traces of recovered panics to the returned errors")
+	traceFile := flag.String("trace-file", "", `file the finished spans are appended to as JSON lines ("-" for stdout)`)
+	biStreamQueueSize := flag.Int("bidi-queue-size", defaultBiStreamQueueSize, "number of HelloBiStreams requests buffered before the server stops reading")
+	overloadRatio := flag.Float64("overload-ratio", 0, "fraction of Hello calls rejected with ResourceExhausted to simulate overload (0 to 1)")
+	drainDelay := flag.Duration("drain-delay", 0, "time to wait after reporting NOT_SERVING before stopping")
+	var logLevel slog.Level
+	flag.TextVar(&logLevel, "log-level", slog.LevelInfo, "minimum level of the logs (DEBUG, INFO, WARN or ERROR)")
+	confLoader := serverconfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// ログにtrace_idとrequest_idを付けて、クライアントのログやスパンと突き合わせられるようにする
+	logger := slog.New(tracing.NewLogHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+
+	// 設定の誤りは待ち受けを始める前に検出する
+	conf, err := confLoader.Load(os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger.Debug("server config", "config", conf)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", conf.Port))
 	if err != nil {
 		panic(err)
 	}
 
-	s := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			myUnaryServerInterceptor1,
-			myUnaryServerInterceptor2,
-		),
-		grpc.ChainStreamInterceptor(
-			myStreamServerInterceptor1,
-			myStreamServerInterceptor2,
-		),
-	)
-	hellopb.RegisterGreetingServiceServer(s, NewMyServer())
+	registry := metrics.NewRegistry()
+
+	// トレースコンテキストは常に引き継ぎ、スパンの書き出しはフラグがあるときだけ行う
+	var exporter tracing.Exporter
+	if *traceFile != "" {
+		e, err := tracing.NewFileExporter(*traceFile)
+		if err != nil {
+			panic(err)
+		}
+		defer e.Close()
+		exporter = e
+	}
+	c := &chain{
+		tracer:  tracing.NewTracer(exporter),
+		metrics: metrics.NewServerMetrics(registry),
+		logger:  logger,
+		recovery: []recovery.Option{
+			recovery.WithLogger(logger),
+			recovery.WithDebug(*debugErrors),
+			recovery.WithPanicCounter(registry.NewCounterVec("grpc_server_panics_total",
+				"Total number of panics recovered in RPC handlers.", "grpc_method")),
+		},
+	}
+	if *tokensFile != "" {
+		tokens, err := auth.LoadStaticTokens(*tokensFile)
+		if err != nil {
+			panic(err)
+		}
+		c.tokens = tokens
+	}
+	if *limitsFile != "" {
+		conf, err := ratelimit.LoadConfig(*limitsFile)
+		if err != nil {
+			panic(err)
+		}
+		c.limiter = ratelimit.New(conf,
+			ratelimit.WithCounter(registry.NewCounterVec("grpc_server_ratelimit_requests_total",
+				"Total number of requests checked by the rate limiter, by result.", "grpc_method", "result")))
+	}
+	interceptorOpts := c.serverOptions()
+
+	serverOpts := append(conf.ServerOptions(), interceptorOpts...)
+	if tlsConf.Enabled() {
+		// gRPCとHTTPで同じポートを使うため、TLSは振り分けの前に終端する
+		// gRPCのサーバーにはハンドシェイク済みの状態を渡し、mTLSのクライアント証明書をピアの情報として使えるようにする
+		// 証明書ファイルの更新はハンドシェイク時に反映されるので、サーバーの再起動は不要
+		tlsConfig, err := tlsutil.NewServerTLSConfig(tlsConf)
+		if err != nil {
+			panic(err)
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+		serverOpts = append(serverOpts, grpc.Creds(connmux.TLSCredentials()))
+	}
+	greeting := NewMyServer()
+	greeting.biStreamQueueSize = *biStreamQueueSize
+	if *overloadRatio > 0 {
+		ratio := *overloadRatio
+		greeting.overloaded = func() bool { return rand.Float64() < ratio }
+	}
+	s := grpc.NewServer(serverOpts...)
+	hellopb.RegisterGreetingServiceServer(s, greeting)
 
 	healthSrv := health.NewServer()
 	healthpb.RegisterHealthServer(s, healthSrv)
-	healthSrv.SetServingStatus("mygrpc", healthpb.HealthCheckResponse_SERVING)
-	// healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthMgr := healthcheck.NewManager(healthSrv, healthcheck.WithLogger(logger))
+	// k8sのreadinessProbeとロードバランサーが見るserverconfig.HealthServiceにプローブを登録する
+	// DBなどの依存先を追加したら、そのプローブも同じサービスに登録する
+	healthMgr.Register(serverconfig.HealthService, "listener", listenerProbe(listener.Addr()))
 
 	reflection.Register(s)
 
+	gw, gatewayGRPC, err := newGatewayHandler(greeting, interceptorOpts...)
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	mux.Handle("/healthz", healthMgr)
+	mux.Handle("/v1/", gw)
+	httpSrv := &http.Server{Handler: mux}
+
+	m := connmux.New(listener)
+	go s.Serve(m.HTTP2())
 	go func() {
-		log.Printf("start gRPC server port: %v", port)
-		s.Serve(listener)
+		if err := httpSrv.Serve(m.HTTP1()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println(err)
+		}
 	}()
+	go func() {
+		log.Printf("start gRPC and HTTP server port: %v", conf.Port)
+		if err := m.Serve(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	ctx, stopHealth := context.WithCancel(context.Background())
+	go healthMgr.Run(ctx)
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 	log.Println("stopping gRPC server...")
-	s.GracefulStop()
+
+	// 先にNOT_SERVINGにして、ロードバランサーがこのサーバーを外すのを待ってから止める
+	stopHealth()
+	healthMgr.Shutdown()
+	time.Sleep(*drainDelay)
+
+	// gRPCとHTTPの処理中のリクエストを並行して待つ
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.GracefulStop()
+	}()
+	go func() {
+		defer wg.Done()
+		httpSrv.Shutdown(context.Background())
+		// ゲートウェイ経由の呼び出しが終わってから中のgRPCサーバーを止める
+		gatewayGRPC.GracefulStop()
+	}()
+	wg.Wait()
+	m.Close()
+}
+
+// listenerProbe はサーバー自身のポートに接続できるかを確認する
+// 待ち受けが閉じたり、接続を受け付けられなくなったりしたら準備完了ではなくなる
+func listenerProbe(addr net.Addr) healthcheck.Probe {
+	_, port, _ := net.SplitHostPort(addr.String())
+	target := net.JoinHostPort("localhost", port)
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
 }
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"mygrpc/internal/grpctest"
+	"mygrpc/pkg/connmux"
+	"mygrpc/pkg/gateway"
+	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/interceptor/auth"
+	"mygrpc/pkg/interceptor/ratelimit"
+	"mygrpc/pkg/metrics"
+	"mygrpc/pkg/tlsutil"
+	"mygrpc/pkg/tlsutil/tlstest"
+	"mygrpc/pkg/tracing"
+)
+
+func TestHelloErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		overloaded bool
+		reqName    string
+		wantCode   codes.Code
+		check      func(t *testing.T, details []interface{})
+	}{
+		{
+			name:     "valid name",
+			reqName:  "hsaki",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "empty name",
+			reqName:  "",
+			wantCode: codes.InvalidArgument,
+			check:    wantFieldViolation("name must not be empty"),
+		},
+		{
+			name:     "too long name",
+			reqName:  strings.Repeat("あ", maxNameLength+1),
+			wantCode: codes.InvalidArgument,
+			check:    wantFieldViolation("name must be at most 64 characters"),
+		},
+		{
+			name:       "overloaded",
+			overloaded: true,
+			reqName:    "hsaki",
+			wantCode:   codes.ResourceExhausted,
+			check: func(t *testing.T, details []interface{}) {
+				if len(details) != 1 {
+					t.Fatalf("got %d details, want 1", len(details))
+				}
+				info, ok := details[0].(*errdetails.RetryInfo)
+				if !ok {
+					t.Fatalf("detail type = %T, want *errdetails.RetryInfo", details[0])
+				}
+				if got := info.GetRetryDelay().AsDuration(); got != time.Second {
+					t.Errorf("retry delay = %s, want 1s", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewMyServer()
+			srv.overloaded = func() bool { return tt.overloaded }
+			client := newHarness(t, withServer(srv)).client
+
+			_, err := client.Hello(context.Background(), &hellopb.HelloRequest{Name: tt.reqName})
+			stat := status.Convert(err)
+			if stat.Code() != tt.wantCode {
+				t.Fatalf("code = %s, want %s", stat.Code(), tt.wantCode)
+			}
+			if tt.check != nil {
+				tt.check(t, stat.Details())
+			}
+		})
+	}
+}
+
+func wantFieldViolation(description string) func(t *testing.T, details []interface{}) {
+	return func(t *testing.T, details []interface{}) {
+		t.Helper()
+		if len(details) != 1 {
+			t.Fatalf("got %d details, want 1", len(details))
+		}
+		br, ok := details[0].(*errdetails.BadRequest)
+		if !ok {
+			t.Fatalf("detail type = %T, want *errdetails.BadRequest", details[0])
+		}
+		violations := br.GetFieldViolations()
+		if len(violations) != 1 {
+			t.Fatalf("got %d violations, want 1", len(violations))
+		}
+		if violations[0].GetField() != "name" || violations[0].GetDescription() != description {
+			t.Errorf("violation = %v, want name: %s", violations[0], description)
+		}
+	}
+}
+
+func TestHelloServerStreamParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       *hellopb.HelloRequest
+		wantCode  codes.Code
+		wantCount int
+	}{
+		{
+			name:      "custom count and interval",
+			req:       &hellopb.HelloRequest{Name: "hsaki", Count: proto.Int32(3), Interval: durationpb.New(time.Millisecond)},
+			wantCode:  codes.OK,
+			wantCount: 3,
+		},
+		{
+			name:     "count over the maximum",
+			req:      &hellopb.HelloRequest{Name: "hsaki", Count: proto.Int32(maxStreamCount + 1)},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "zero count",
+			req:      &hellopb.HelloRequest{Name: "hsaki", Count: proto.Int32(0)},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "interval over the maximum",
+			req:      &hellopb.HelloRequest{Name: "hsaki", Interval: durationpb.New(maxStreamInterval + time.Second)},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	client := newHarness(t).client
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.HelloServerStream(context.Background(), tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := grpctest.Collect(stream.Recv)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %s, want %s (%v)", code, tt.wantCode, err)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("got %d responses, want %d", len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestHelloServerStreamCancel(t *testing.T) {
+	h := newHarness(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := h.client.HelloServerStream(ctx, &hellopb.HelloRequest{
+		Name:     "hsaki",
+		Count:    proto.Int32(maxStreamCount),
+		Interval: durationpb.New(maxStreamInterval),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := grpctest.Collect(grpctest.CancelAfter(1, cancel, stream.Recv))
+	if len(got) != 1 || status.Code(err) != codes.Canceled {
+		t.Fatalf("got %d responses and %v, want 1 and Canceled", len(got), err)
+	}
+
+	// 10秒の待機中でもキャンセルされればすぐにハンドラが終わる
+	if code := status.Code(h.waitHandler(t, time.Second)); code != codes.Canceled {
+		t.Errorf("handler code = %s, want Canceled", code)
+	}
+}
+
+func TestHello(t *testing.T) {
+	h := newHarness(t)
+
+	var header, trailer metadata.MD
+	res, err := h.client.Hello(context.Background(), &hellopb.HelloRequest{Name: "hsaki"}, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetMessage() != "Hello, hsaki!" {
+		t.Errorf("message = %q", res.GetMessage())
+	}
+	grpctest.AssertMetadata(t, "header", header, map[string]string{"type": "unary", "from": "server", "in": "header"})
+	grpctest.AssertMetadata(t, "trailer", trailer, map[string]string{"type": "unary", "from": "server", "in": "trailer"})
+	if len(header.Get(tracing.RequestIDKey)) != 1 {
+		t.Errorf("header has no request id: %v", header)
+	}
+}
+
+func TestHelloServerStream(t *testing.T) {
+	h := newHarness(t)
+
+	stream, err := h.client.HelloServerStream(context.Background(), &hellopb.HelloRequest{
+		Name:     "hsaki",
+		Count:    proto.Int32(3),
+		Interval: durationpb.New(time.Millisecond),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := grpctest.Collect(stream.Recv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"[0] Hello, hsaki!", "[1] Hello, hsaki!", "[2] Hello, hsaki!"}
+	if got := messages(got); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+	if err := h.waitHandler(t, time.Second); err != nil {
+		t.Errorf("handler error = %v", err)
+	}
+}
+
+func TestHelloClientStream(t *testing.T) {
+	h := newHarness(t)
+
+	stream, err := h.client.HelloClientStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := stream.Send(&hellopb.HelloRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetMessage() != "Hello, [a b c]!" {
+		t.Errorf("message = %q", res.GetMessage())
+	}
+}
+
+func TestHelloBiStreams(t *testing.T) {
+	h := newHarness(t)
+
+	stream, err := h.client.HelloBiStreams(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpctest.AssertMetadata(t, "header", header, map[string]string{"type": "stream", "from": "server", "in": "header"})
+
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		if err := stream.Send(&hellopb.HelloRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := grpctest.Collect(stream.Recv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(names) {
+		t.Fatalf("got %d responses, want %d", len(got), len(names))
+	}
+	for i, name := range names {
+		if want := fmt.Sprintf("Hello, %s!", name); got[i].GetMessage() != want {
+			t.Errorf("response %d = %q, want %q", i, got[i].GetMessage(), want)
+		}
+	}
+	grpctest.AssertMetadata(t, "trailer", stream.Trailer(), map[string]string{"type": "stream", "from": "server", "in": "trailer"})
+}
+
+func TestChain(t *testing.T) {
+	h := newHarness(t, withChain(func(c *chain) {
+		c.tokens = auth.StaticTokens{"secret": "hsaki"}
+	}))
+
+	_, err := h.client.Hello(context.Background(), &hellopb.HelloRequest{Name: "hsaki"})
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Fatalf("code without token = %s, want Unauthenticated", code)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if _, err := h.client.Hello(ctx, &hellopb.HelloRequest{Name: "hsaki"}); err != nil {
+		t.Fatalf("call with token: %v", err)
+	}
+
+	// 認証エラーもチェーンの外側にあるログとメトリクスに記録される
+	var b strings.Builder
+	if err := h.registry.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"OK", "Unauthenticated"} {
+		want := fmt.Sprintf(`grpc_server_handled_total{grpc_type="unary",grpc_method="/myapp.GreetingService/Hello",grpc_code=%q} 1`, code)
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+	if logs := h.logs.String(); !strings.Contains(logs, `"grpc.code":"Unauthenticated"`) || !strings.Contains(logs, `"request_id":`) {
+		t.Errorf("logs = %s", logs)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	h := newHarness(t, withChain(func(c *chain) {
+		c.tokens = auth.StaticTokens{"secret": "hsaki"}
+		c.limiter = ratelimit.New(ratelimit.Config{
+			Default: ratelimit.Limit{Rate: 0.001, Burst: 2},
+		})
+	}))
+
+	// mygrpc reflectと同じく、トークンなしでサービスの一覧とディスクリプタを取得できる
+	stream, err := rpb.NewServerReflectionClient(h.conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := []*rpb.ServerReflectionRequest{
+		{MessageRequest: &rpb.ServerReflectionRequest_ListServices{}},
+		{MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "myapp.GreetingService"}},
+	}
+	var responses []*rpb.ServerReflectionResponse
+	for _, req := range requests {
+		if err := stream.Send(req); err != nil {
+			t.Fatal(err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := res.GetErrorResponse(); e != nil {
+			t.Fatalf("error response = %s", e.GetErrorMessage())
+		}
+		responses = append(responses, res)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	// burstちょうどのメッセージなら、閉じるときにレート制限されない
+	if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+		t.Fatalf("end of stream = %v, want io.EOF", err)
+	}
+
+	var services []string
+	for _, s := range responses[0].GetListServicesResponse().GetService() {
+		services = append(services, s.GetName())
+	}
+	if !slices.Contains(services, "myapp.GreetingService") {
+		t.Errorf("services = %v, want myapp.GreetingService", services)
+	}
+	if len(responses[1].GetFileDescriptorResponse().GetFileDescriptorProto()) == 0 {
+		t.Error("no file descriptor for myapp.GreetingService")
+	}
+}
+
+func TestGatewayRateLimit(t *testing.T) {
+	c := &chain{
+		tracer:  tracing.NewTracer(nil),
+		metrics: metrics.NewServerMetrics(metrics.NewRegistry()),
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		limiter: ratelimit.New(ratelimit.Config{
+			Methods: map[string]ratelimit.Limit{
+				"/myapp.GreetingService/Hello": {Rate: 0.001, Burst: 1},
+			},
+		}),
+	}
+	gw, s, err := newGatewayHandler(NewMyServer(), c.serverOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+
+	hello := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/hello", strings.NewReader(`{"name":"hsaki"}`))
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := hello("192.0.2.1:1234", ""); code != http.StatusOK {
+		t.Fatalf("first call of client 1: status = %d, want 200", code)
+	}
+	if code := hello("192.0.2.1:1235", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("second call of client 1: status = %d, want 429", code)
+	}
+	// X-Forwarded-Forを書き換えても、ゲートウェイが見たアドレスで制限される
+	if code := hello("192.0.2.1:1236", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("call of client 1 with X-Forwarded-For: status = %d, want 429", code)
+	}
+	// 別のHTTPクライアントは自分のバケットを持つ
+	if code := hello("192.0.2.2:1234", ""); code != http.StatusOK {
+		t.Fatalf("call of client 2: status = %d, want 200", code)
+	}
+}
+
+func TestForwardedForFromGRPC(t *testing.T) {
+	h := newHarness(t, withChain(func(c *chain) {
+		c.limiter = ratelimit.New(ratelimit.Config{
+			Methods: map[string]ratelimit.Limit{
+				"/myapp.GreetingService/Hello": {Rate: 0.001, Burst: 1},
+			},
+		}, ratelimit.WithIdentityMetadataKey("x-client-id"))
+	}))
+
+	// gRPCで直接呼ぶクライアントが送ったアドレスやIDは使われず、毎回変えても同じバケットになる
+	for i := 0; i < 2; i++ {
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			gateway.ForwardedForMetadataKey, fmt.Sprintf("198.51.100.%d", i),
+			"x-client-id", fmt.Sprint("client-", i),
+		)
+		_, err := h.client.Hello(ctx, &hellopb.HelloRequest{Name: "hsaki"})
+		if i == 0 && err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 && status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("code with another address = %s, want ResourceExhausted", status.Code(err))
+		}
+	}
+}
+
+func TestTLS(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	serverPair := ca.IssueServer(t, "127.0.0.1")
+	clientPair := ca.IssueClient(t, "alice")
+	serverConf, err := tlsutil.NewServerTLSConfig(tlsutil.ServerConfig{
+		CertFile:     serverPair.CertFile,
+		KeyFile:      serverPair.KeyFile,
+		ClientCAFile: ca.CertFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConf := func() *tls.Config {
+		conf, err := tlsutil.NewClientTLSConfig(tlsutil.ClientConfig{
+			CAFile:   ca.CertFile,
+			CertFile: clientPair.CertFile,
+			KeyFile:  clientPair.KeyFile,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conf
+	}
+
+	// gRPCのハンドラにmTLSのクライアント証明書が届いているかを記録する
+	commonNames := make(chan string, 1)
+	s := grpc.NewServer(grpc.Creds(connmux.TLSCredentials()), grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var cn string
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+				cn = tlsInfo.State.PeerCertificates[0].Subject.CommonName
+			}
+		}
+		commonNames <- cn
+		return handler(ctx, req)
+	}))
+	hellopb.RegisterGreetingServiceServer(s, NewMyServer())
+	gw, gatewayGRPC, err := newGatewayHandler(NewMyServer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(gatewayGRPC.Stop)
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", gw)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := connmux.New(tls.NewListener(lis, serverConf))
+	httpSrv := &http.Server{Handler: mux}
+	go s.Serve(m.HTTP2())
+	go httpSrv.Serve(m.HTTP1())
+	go m.Serve()
+	t.Cleanup(func() {
+		httpSrv.Close()
+		s.Stop()
+		m.Close()
+	})
+
+	// HTTP/2も話せるHTTPクライアントはALPNでhttp/1.1になり、gRPCサーバーではなくゲートウェイに届く
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConf(), ForceAttemptHTTP2: true}}
+	t.Cleanup(client.CloseIdleConnections)
+	res, err := client.Post("https://"+lis.Addr().String()+"/v1/hello", "application/json", strings.NewReader(`{"name":"hsaki"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.ProtoMajor != 1 {
+		t.Errorf("protocol = %s, want HTTP/1.1", res.Proto)
+	}
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "Hello, hsaki!") {
+		t.Errorf("gateway response = %d %s", res.StatusCode, body)
+	}
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientConf())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := hellopb.NewGreetingServiceClient(conn).Hello(context.Background(), &hellopb.HelloRequest{Name: "hsaki"}); err != nil {
+		t.Fatal(err)
+	}
+	if cn := <-commonNames; cn != "alice" {
+		t.Errorf("client certificate common name = %q, want alice", cn)
+	}
+}
+
+func TestHelloBiStreamsSlowConsumer(t *testing.T) {
+	srv := NewMyServer()
+	srv.biStreamQueueSize = 4
+	h := newHarness(t, withServer(srv))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := h.client.HelloBiStreams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 応答を読まないクライアントが、合計で数十MBになるリクエストを送り続ける
+	const total = 20000
+	name := strings.Repeat("x", 1024)
+	var sent atomic.Int64
+	sendDone := make(chan error, 1)
+	go func() {
+		for i := 0; i < total; i++ {
+			if err := stream.Send(&hellopb.HelloRequest{Name: name}); err != nil {
+				sendDone <- err
+				return
+			}
+			sent.Add(1)
+		}
+		sendDone <- stream.CloseSend()
+	}()
+
+	// 送信が止まるまで待つ
+	stalled := waitStable(t, sent.Load)
+	received := h.receivedMessages(t, "/myapp.GreetingService/HelloBiStreams")
+	if stalled >= total {
+		t.Fatalf("all %d requests were sent without the client reading any response", total)
+	}
+	t.Logf("sender stalled after %d requests, server received %d", stalled, received)
+
+	// 止まっている間はサーバーもそれ以上読み込まない
+	time.Sleep(200 * time.Millisecond)
+	if got := h.receivedMessages(t, "/myapp.GreetingService/HelloBiStreams"); got != received {
+		t.Errorf("server kept receiving while stalled: %d -> %d", received, got)
+	}
+
+	// 読み始めれば最後まで流れる
+	got, err := grpctest.Collect(stream.Recv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != total {
+		t.Errorf("got %d responses, want %d", len(got), total)
+	}
+	if err := <-sendDone; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitStable はvalueが一定時間変わらなくなるまで待ち、その値を返す
+func waitStable(t *testing.T, value func() int64) int64 {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	last := value()
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		v := value()
+		if v == last {
+			return v
+		}
+		last = v
+	}
+	t.Fatal("value did not stop changing")
+	return 0
+}
@@ -0,0 +1,119 @@
+// Package grpctest runs gRPC servers over an in-memory bufconn listener
+// and provides helpers shared by the tests of this module.
+package grpctest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	hellopb "mygrpc/pkg/grpc"
+)
+
+const bufSize = 1024 * 1024
+
+// Server is a gRPC server listening on a bufconn listener.
+type Server struct {
+	*grpc.Server
+
+	lis *bufconn.Listener
+}
+
+// NewServer creates a server with opts, lets register add services to it
+// and starts serving. The server is stopped when the test finishes.
+func NewServer(t testing.TB, register func(*grpc.Server), opts ...grpc.ServerOption) *Server {
+	t.Helper()
+
+	s := &Server{Server: grpc.NewServer(opts...), lis: bufconn.Listen(bufSize)}
+	register(s.Server)
+	go s.Serve(s.lis)
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// Dialer returns a DialOption that connects to s regardless of the target.
+func (s *Server) Dialer() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return s.lis.DialContext(ctx)
+	})
+}
+
+// Dial connects to s without TLS unless opts set other credentials.
+// The connection is closed when the test finishes.
+func (s *Server) Dial(t testing.TB, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+
+	opts = append([]grpc.DialOption{
+		s.Dialer(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	conn, err := grpc.Dial("bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// NewGreeting serves srv as the GreetingService and returns a client for it
+// together with its connection, which can call other services on the server.
+func NewGreeting(t testing.TB, srv hellopb.GreetingServiceServer, opts ...grpc.ServerOption) (hellopb.GreetingServiceClient, *grpc.ClientConn) {
+	t.Helper()
+
+	s := NewServer(t, func(s *grpc.Server) {
+		hellopb.RegisterGreetingServiceServer(s, srv)
+	}, opts...)
+	conn := s.Dial(t)
+	return hellopb.NewGreetingServiceClient(conn), conn
+}
+
+// CancelAfter wraps recv so that cancel is called once n messages have
+// been received, to cancel a stream from the client in the middle.
+func CancelAfter[T any](n int, cancel context.CancelFunc, recv func() (T, error)) func() (T, error) {
+	var count int
+	return func() (T, error) {
+		res, err := recv()
+		if err == nil {
+			count++
+			if count == n {
+				cancel()
+			}
+		}
+		return res, err
+	}
+}
+
+// Collect calls recv until io.EOF or an error and returns the received
+// messages. The error is nil when the stream ended with io.EOF.
+func Collect[T any](recv func() (T, error)) ([]T, error) {
+	var got []T
+	for {
+		res, err := recv()
+		if errors.Is(err, io.EOF) {
+			return got, nil
+		}
+		if err != nil {
+			return got, err
+		}
+		got = append(got, res)
+	}
+}
+
+// AssertMetadata reports an error unless md has exactly one value for each
+// key in want and it matches. Other keys in md are ignored.
+func AssertMetadata(t testing.TB, name string, md metadata.MD, want map[string]string) {
+	t.Helper()
+	for k, v := range want {
+		got := md.Get(k)
+		if len(got) != 1 || got[0] != v {
+			t.Errorf("%s[%q] = %v, want [%s]", name, k, got, v)
+		}
+	}
+}
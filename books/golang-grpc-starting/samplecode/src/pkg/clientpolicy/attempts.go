@@ -0,0 +1,101 @@
+package clientpolicy
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// AttemptLogger logs every attempt of an RPC, including the ones grpc-go
+// makes internally for retryPolicy and the hedged ones.
+//
+// Retries happen below the interceptors, so the attempts are observed with a
+// stats.Handler. Its interceptors number the attempts of each RPC, so install
+// both with DialOptions (or WithStatsHandler and the interceptors).
+type AttemptLogger struct {
+	logger *slog.Logger
+}
+
+var _ stats.Handler = (*AttemptLogger)(nil)
+
+// NewAttemptLogger returns an AttemptLogger that writes to logger.
+// slog.Default() is used if logger is nil.
+func NewAttemptLogger(logger *slog.Logger) *AttemptLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &AttemptLogger{logger: logger}
+}
+
+type attemptCounterKey struct{}
+
+type attemptInfoKey struct{}
+
+type attemptInfo struct {
+	method string
+	number int64
+}
+
+// UnaryClientInterceptor returns an interceptor that starts numbering the
+// attempts of a unary RPC.
+func (a *AttemptLogger) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withAttemptCounter(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that starts numbering the
+// attempts of a streaming RPC.
+func (a *AttemptLogger) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withAttemptCounter(ctx), desc, cc, method, opts...)
+	}
+}
+
+func withAttemptCounter(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(attemptCounterKey{}).(*atomic.Int64); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, attemptCounterKey{}, new(atomic.Int64))
+}
+
+// TagRPC is called once per attempt.
+func (a *AttemptLogger) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	var n int64
+	if counter, ok := ctx.Value(attemptCounterKey{}).(*atomic.Int64); ok {
+		n = counter.Add(1)
+	}
+	return context.WithValue(ctx, attemptInfoKey{}, attemptInfo{method: info.FullMethodName, number: n})
+}
+
+// HandleRPC logs the result of each attempt when it ends.
+func (a *AttemptLogger) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	end, ok := s.(*stats.End)
+	if !ok || !end.IsClient() {
+		return
+	}
+	info, _ := ctx.Value(attemptInfoKey{}).(attemptInfo)
+
+	level := slog.LevelInfo
+	if end.Error != nil {
+		level = slog.LevelWarn
+	}
+	a.logger.LogAttrs(ctx, level, "rpc attempt",
+		slog.String("grpc.method", info.method),
+		slog.Int64("grpc.attempt", info.number),
+		slog.String("grpc.code", status.Code(end.Error).String()),
+		slog.Duration("grpc.duration", end.EndTime.Sub(end.BeginTime)),
+	)
+}
+
+// TagConn implements stats.Handler.
+func (a *AttemptLogger) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (a *AttemptLogger) HandleConn(context.Context, stats.ConnStats) {}
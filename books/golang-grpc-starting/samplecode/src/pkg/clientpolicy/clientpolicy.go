@@ -0,0 +1,28 @@
+// Package clientpolicy applies a gRPC service config to the client: default
+// timeouts and retries through grpc-go, hedging through an interceptor, and
+// per-attempt logging.
+package clientpolicy
+
+import (
+	"log/slog"
+
+	"google.golang.org/grpc"
+)
+
+// DialOptions returns the options that apply conf to a client connection
+// and log each attempt to logger.
+func DialOptions(conf *ServiceConfig, logger *slog.Logger) []grpc.DialOption {
+	attempts := NewAttemptLogger(logger)
+	return []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(conf.raw),
+		grpc.WithStatsHandler(attempts),
+		// 試行の番号付けはヘッジングよりも外側で始める
+		grpc.WithChainUnaryInterceptor(
+			attempts.UnaryClientInterceptor(),
+			HedgingInterceptor(conf),
+		),
+		grpc.WithChainStreamInterceptor(
+			attempts.StreamClientInterceptor(),
+		),
+	}
+}
@@ -0,0 +1,293 @@
+package clientpolicy_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"mygrpc/internal/grpctest"
+	"mygrpc/pkg/clientpolicy"
+	hellopb "mygrpc/pkg/grpc"
+)
+
+const serviceConfig = `{
+	"methodConfig": [
+		{
+			"name": [{"service": "myapp.GreetingService", "method": "Hello"}],
+			"timeout": "2s",
+			"hedgingPolicy": {
+				"maxAttempts": 3,
+				"hedgingDelay": "0.1s",
+				"nonFatalStatusCodes": ["UNAVAILABLE"]
+			}
+		},
+		{
+			"name": [{"service": "myapp.GreetingService", "method": "HelloServerStream"}],
+			"timeout": "0.5s",
+			"retryPolicy": {
+				"maxAttempts": 3,
+				"initialBackoff": "0.01s",
+				"maxBackoff": "0.1s",
+				"backoffMultiplier": 2,
+				"retryableStatusCodes": ["UNAVAILABLE"]
+			}
+		}
+	]
+}`
+
+// faultyServer は最初のfailFirst回の呼び出しを失敗させる
+type faultyServer struct {
+	hellopb.UnimplementedGreetingServiceServer
+
+	failFirst int64
+	failCode  codes.Code
+	hangFirst bool // trueなら最初の呼び出しはキャンセルされるまで返さない
+	calls     atomic.Int64
+}
+
+func (s *faultyServer) Hello(ctx context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
+	n := s.calls.Add(1)
+	if s.hangFirst && n == 1 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if n <= s.failFirst {
+		return nil, status.Errorf(s.failCode, "injected failure %d", n)
+	}
+	return &hellopb.HelloResponse{Message: "Hello, " + req.GetName() + "!"}, nil
+}
+
+func (s *faultyServer) HelloServerStream(req *hellopb.HelloRequest, stream hellopb.GreetingService_HelloServerStreamServer) error {
+	n := s.calls.Add(1)
+	if s.hangFirst {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+	if n <= s.failFirst {
+		return status.Errorf(s.failCode, "injected failure %d", n)
+	}
+	return stream.Send(&hellopb.HelloResponse{Message: "Hello, " + req.GetName() + "!"})
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newClient(t *testing.T, srv *faultyServer) (hellopb.GreetingServiceClient, *syncBuffer) {
+	t.Helper()
+
+	conf, err := clientpolicy.ParseServiceConfig([]byte(serviceConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := grpctest.NewServer(t, func(s *grpc.Server) {
+		hellopb.RegisterGreetingServiceServer(s, srv)
+	})
+
+	logs := &syncBuffer{}
+	conn := s.Dial(t, clientpolicy.DialOptions(conf, slog.New(slog.NewTextHandler(logs, nil)))...)
+	return hellopb.NewGreetingServiceClient(conn), logs
+}
+
+func TestHedging(t *testing.T) {
+	tests := []struct {
+		name      string
+		srv       *faultyServer
+		wantCode  codes.Code
+		wantCalls int64
+		maxTime   time.Duration
+	}{
+		{
+			name:      "non-fatal failures are hedged",
+			srv:       &faultyServer{failFirst: 2, failCode: codes.Unavailable},
+			wantCode:  codes.OK,
+			wantCalls: 3,
+			maxTime:   time.Second,
+		},
+		{
+			name:      "gives up after maxAttempts",
+			srv:       &faultyServer{failFirst: 5, failCode: codes.Unavailable},
+			wantCode:  codes.Unavailable,
+			wantCalls: 3,
+			maxTime:   time.Second,
+		},
+		{
+			name:      "fatal failure is returned immediately",
+			srv:       &faultyServer{failFirst: 1, failCode: codes.InvalidArgument},
+			wantCode:  codes.InvalidArgument,
+			wantCalls: 1,
+			maxTime:   time.Second,
+		},
+		{
+			name:      "slow attempt is overtaken after hedgingDelay",
+			srv:       &faultyServer{hangFirst: true},
+			wantCode:  codes.OK,
+			wantCalls: 2,
+			maxTime:   time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, logs := newClient(t, tt.srv)
+
+			start := time.Now()
+			res, err := client.Hello(context.Background(), &hellopb.HelloRequest{Name: "hsaki"})
+			elapsed := time.Since(start)
+
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %s, want %s (%v)", got, tt.wantCode, err)
+			}
+			if err == nil && res.GetMessage() != "Hello, hsaki!" {
+				t.Errorf("message = %q", res.GetMessage())
+			}
+			if elapsed > tt.maxTime {
+				t.Errorf("took %s, want at most %s", elapsed, tt.maxTime)
+			}
+			// キャンセルされた試行がサーバーに届くのを待つ
+			time.Sleep(50 * time.Millisecond)
+			if got := tt.srv.calls.Load(); got != tt.wantCalls {
+				t.Errorf("server got %d calls, want %d", got, tt.wantCalls)
+			}
+			if got := strings.Count(logs.String(), "msg=\"rpc attempt\""); int64(got) < tt.wantCalls {
+				t.Errorf("logged %d attempts, want at least %d:\n%s", got, tt.wantCalls, logs)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	srv := &faultyServer{failFirst: 2, failCode: codes.Unavailable}
+	client, logs := newClient(t, srv)
+
+	stream, err := client.HelloServerStream(context.Background(), &hellopb.HelloRequest{Name: "hsaki"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv() = %v", err)
+		}
+		messages = append(messages, res.GetMessage())
+	}
+
+	if len(messages) != 1 {
+		t.Errorf("got %d messages, want 1", len(messages))
+	}
+	if got := srv.calls.Load(); got != 3 {
+		t.Errorf("server got %d calls, want 3", got)
+	}
+	for i := 1; i <= 3; i++ {
+		if !strings.Contains(logs.String(), "grpc.attempt="+strconv.Itoa(i)) {
+			t.Errorf("attempt %d was not logged:\n%s", i, logs)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	client, _ := newClient(t, &faultyServer{hangFirst: true})
+
+	stream, err := client.HelloServerStream(context.Background(), &hellopb.HelloRequest{Name: "hsaki"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if got := status.Code(err); got != codes.DeadlineExceeded {
+		t.Errorf("code = %s, want DeadlineExceeded", got)
+	}
+}
+
+func TestParseServiceConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{
+			name: "retry and hedging together",
+			json: `{"methodConfig": [{"name": [{}], "retryPolicy": {}, "hedgingPolicy": {"maxAttempts": 2}}]}`,
+		},
+		{
+			name: "too few attempts",
+			json: `{"methodConfig": [{"name": [{}], "hedgingPolicy": {"maxAttempts": 1}}]}`,
+		},
+		{
+			name: "delay without unit",
+			json: `{"methodConfig": [{"name": [{}], "hedgingPolicy": {"maxAttempts": 2, "hedgingDelay": "100"}}]}`,
+		},
+		{
+			name: "unknown status code",
+			json: `{"methodConfig": [{"name": [{}], "hedgingPolicy": {"maxAttempts": 2, "nonFatalStatusCodes": ["BROKEN"]}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := clientpolicy.ParseServiceConfig([]byte(tt.json)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestWithLoadBalancing(t *testing.T) {
+	base, err := clientpolicy.ParseServiceConfig([]byte(serviceConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// grpc-goはダイヤル時にサービス設定を検証し、未知のポリシーを拒否する
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: "round_robin"},
+		{policy: "pick_first"},
+		{policy: "no_such_policy", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			sc, err := base.WithLoadBalancing(tt.policy, "mygrpc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := append(clientpolicy.DialOptions(sc, nil), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			conn, err := grpc.Dial("localhost:0", opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		})
+	}
+}
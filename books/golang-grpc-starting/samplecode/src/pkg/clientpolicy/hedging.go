@@ -0,0 +1,115 @@
+package clientpolicy
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type attemptResult struct {
+	reply   proto.Message
+	header  metadata.MD
+	trailer metadata.MD
+	err     error
+}
+
+// HedgingInterceptor returns a unary client interceptor that sends hedged
+// requests for the methods that have a hedgingPolicy in conf.
+//
+// The first attempt is sent immediately and another one every HedgingDelay
+// (or as soon as an attempt fails with a non-fatal code) until MaxAttempts
+// are in flight. The first response that is OK or fails with a fatal code
+// is returned and the remaining attempts are cancelled.
+func HedgingInterceptor(conf *ServiceConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy, ok := conf.hedgingPolicy(method)
+		replyMsg, isProto := reply.(proto.Message)
+		if !ok || !isProto {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel() // 負けた試行はここでキャンセルされる
+
+		results := make(chan attemptResult, policy.MaxAttempts)
+		send := func() {
+			r := attemptResult{reply: replyMsg.ProtoReflect().New().Interface()}
+			// 同時に走る試行同士でヘッダー/トレーラーの書き込み先が競合しないよう試行ごとに差し替える
+			attemptOpts := replaceMetadataOptions(opts, &r.header, &r.trailer)
+			go func() {
+				r.err = invoker(ctx, method, req, r.reply, cc, attemptOpts...)
+				results <- r
+			}()
+		}
+
+		send()
+		sent, finished := 1, 0
+		timer := time.NewTimer(policy.HedgingDelay)
+		defer timer.Stop()
+
+		var last attemptResult
+		for finished < sent {
+			select {
+			case <-timer.C:
+				if sent < policy.MaxAttempts {
+					send()
+					sent++
+					timer.Reset(policy.HedgingDelay)
+				}
+			case r := <-results:
+				finished++
+				last = r
+				if r.err == nil || !policy.isNonFatal(status.Code(r.err)) {
+					return deliver(r, replyMsg, opts)
+				}
+				// 致命的でないエラーは待たずに次の試行を送る
+				if sent < policy.MaxAttempts {
+					send()
+					sent++
+					if !timer.Stop() {
+						select {
+						case <-timer.C:
+						default:
+						}
+					}
+					timer.Reset(policy.HedgingDelay)
+				}
+			}
+		}
+		return deliver(last, replyMsg, opts)
+	}
+}
+
+// deliver は採用した試行の結果を呼び出し元のreplyとCallOptionに書き戻す
+func deliver(r attemptResult, reply proto.Message, opts []grpc.CallOption) error {
+	for _, o := range opts {
+		switch o := o.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = r.header
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = r.trailer
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	proto.Reset(reply)
+	proto.Merge(reply, r.reply)
+	return nil
+}
+
+func replaceMetadataOptions(opts []grpc.CallOption, header, trailer *metadata.MD) []grpc.CallOption {
+	replaced := make([]grpc.CallOption, 0, len(opts)+2)
+	for _, o := range opts {
+		switch o.(type) {
+		case grpc.HeaderCallOption, grpc.TrailerCallOption:
+			continue
+		}
+		replaced = append(replaced, o)
+	}
+	return append(replaced, grpc.Header(header), grpc.Trailer(trailer))
+}
@@ -0,0 +1,219 @@
+// Package connmux shares one listener between a gRPC server and an HTTP/1.1
+// server. Each accepted connection is sniffed for the HTTP/2 client preface
+// and handed to the matching child listener.
+//
+// With a TLS listener the preface is sniffed after the handshake. Serve the
+// gRPC side with TLSCredentials, and offer http/1.1 before h2 in ALPN so that
+// HTTP clients, which also support HTTP/2, do not end up on the gRPC server.
+package connmux
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// http2Preface is the first bytes sent by an HTTP/2 client with prior knowledge.
+// gRPC clients always start their connections with it.
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// Mux splits the connections of a listener into HTTP/2 and other traffic.
+type Mux struct {
+	root        net.Listener
+	readTimeout time.Duration
+
+	http2 *childListener
+	other *childListener
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Option configures a Mux.
+type Option func(*Mux)
+
+// WithReadTimeout sets how long a new connection may take to send enough
+// bytes to be classified. The default is 10 seconds.
+func WithReadTimeout(d time.Duration) Option {
+	return func(m *Mux) {
+		m.readTimeout = d
+	}
+}
+
+// New returns a Mux that accepts connections from l once Serve is called.
+func New(l net.Listener, opts ...Option) *Mux {
+	m := &Mux{
+		root:        l,
+		readTimeout: 10 * time.Second,
+		done:        make(chan struct{}),
+	}
+	m.http2 = newChildListener(m)
+	m.other = newChildListener(m)
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// HTTP2 returns the listener of the connections that start with the HTTP/2
+// preface. Pass it to grpc.Server.Serve.
+func (m *Mux) HTTP2() net.Listener {
+	return m.http2
+}
+
+// HTTP1 returns the listener of every other connection. Pass it to
+// http.Server.Serve.
+func (m *Mux) HTTP1() net.Listener {
+	return m.other
+}
+
+// Serve accepts connections until the root listener is closed.
+// It returns nil after Close.
+func (m *Mux) Serve() error {
+	for {
+		conn, err := m.root.Accept()
+		if err != nil {
+			select {
+			case <-m.done:
+				return nil
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			m.Close()
+			return err
+		}
+		// 遅いクライアントで他の接続のAcceptが止まらないように、判定は接続ごとに行う
+		go m.dispatch(conn)
+	}
+}
+
+func (m *Mux) dispatch(conn net.Conn) {
+	br := bufio.NewReaderSize(conn, len(http2Preface))
+	if m.readTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(m.readTimeout))
+	}
+	isHTTP2, err := hasPrefix(br, http2Preface)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	var c net.Conn = &sniffedConn{Conn: conn, r: br}
+	if tc, ok := conn.(*tls.Conn); ok {
+		c = &sniffedTLSConn{sniffedConn: c.(*sniffedConn), tls: tc}
+	}
+	if isHTTP2 {
+		m.http2.deliver(c)
+		return
+	}
+	m.other.deliver(c)
+}
+
+// hasPrefix は読み込んだバイトを消費せずにprefixで始まるかを調べる
+// 一致しないとわかった時点で返るので、短いHTTP/1.1のリクエストでも待たされない
+func hasPrefix(br *bufio.Reader, prefix []byte) (bool, error) {
+	for i := 1; i <= len(prefix); i++ {
+		b, err := br.Peek(i)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(b, prefix[:i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Close closes the root listener and both child listeners.
+// Connections that were already handed out are not closed; the servers
+// drain them during their own graceful shutdown.
+func (m *Mux) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = m.root.Close()
+	})
+	return err
+}
+
+// Addr returns the address of the root listener.
+func (m *Mux) Addr() net.Addr {
+	return m.root.Addr()
+}
+
+type childListener struct {
+	mux    *Mux
+	conns  chan net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newChildListener(m *Mux) *childListener {
+	return &childListener{
+		mux:    m,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *childListener) deliver(c net.Conn) {
+	select {
+	case l.conns <- c:
+	case <-l.closed:
+		c.Close()
+	case <-l.mux.done:
+		c.Close()
+	}
+}
+
+func (l *childListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-l.mux.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops only this child listener so that one server can shut down
+// while the other keeps accepting.
+func (l *childListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *childListener) Addr() net.Addr {
+	return l.mux.root.Addr()
+}
+
+// sniffedConn は判定のために先読みしたバイトを先に返す
+type sniffedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// sniffedTLSConn はTLSCredentialsがハンドシェイクの結果を読めるようにする
+type sniffedTLSConn struct {
+	*sniffedConn
+	tls *tls.Conn
+}
+
+func (c *sniffedTLSConn) ConnectionState() tls.ConnectionState {
+	return c.tls.ConnectionState()
+}
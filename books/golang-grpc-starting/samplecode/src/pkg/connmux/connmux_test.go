@@ -0,0 +1,148 @@
+package connmux_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"mygrpc/pkg/connmux"
+)
+
+func TestMux(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := connmux.New(lis)
+
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	httpSrv := &http.Server{Handler: mux}
+
+	go s.Serve(m.HTTP2())
+	go httpSrv.Serve(m.HTTP1())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- m.Serve() }()
+
+	addr := lis.Addr().String()
+
+	// 同じポートでgRPCとHTTP/1.1の両方が受けられる
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("gRPC call: %v", err)
+	}
+
+	res, err := http.Get("http://" + addr + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(b) != "hello" {
+		t.Errorf("body = %q, want hello", b)
+	}
+
+	// 処理中のHTTPリクエストはシャットダウンしても最後まで返る
+	slow := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		slow <- string(b)
+	}()
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		httpSrv.Shutdown(context.Background())
+		m.Close()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("shutdown finished before the in-flight request")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if got := <-slow; got != "done" {
+		t.Errorf("slow body = %q, want done", got)
+	}
+	<-stopped
+	if err := <-serveErr; err != nil {
+		t.Errorf("Serve() = %v, want nil", err)
+	}
+}
+
+func TestShortHTTP1Request(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := connmux.New(lis, connmux.WithReadTimeout(time.Second))
+	defer m.Close()
+	go m.Serve()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := m.HTTP1().Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	// プリフェースより短い入力でも、一致しないとわかった時点で振り分けられる
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("GET /")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case sc := <-accepted:
+		defer sc.Close()
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(sc, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "GET /" {
+			t.Errorf("read %q, want the sniffed bytes", buf)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("connection was not classified")
+	}
+}
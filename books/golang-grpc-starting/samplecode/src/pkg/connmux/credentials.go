@@ -0,0 +1,53 @@
+package connmux
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSCredentials returns gRPC server credentials for a Mux that accepts from
+// a TLS listener such as the one of tls.NewListener. The Mux has already done
+// the handshake, so the credentials only pass its state on as the
+// credentials.TLSInfo of the peer, which keeps the client certificates of
+// mutual TLS visible to the handlers. Connections without TLS are rejected.
+func TLSCredentials() credentials.TransportCredentials {
+	return tlsCredentials{}
+}
+
+type tlsCredentials struct{}
+
+// tlsStater はハンドシェイク済みのTLSの接続
+type tlsStater interface {
+	ConnectionState() tls.ConnectionState
+}
+
+func (tlsCredentials) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("connmux: TLSCredentials is only for servers")
+}
+
+func (tlsCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	c, ok := conn.(tlsStater)
+	if !ok {
+		return nil, nil, errors.New("connmux: connection is not TLS")
+	}
+	return conn, credentials.TLSInfo{
+		State:          c.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}, nil
+}
+
+func (tlsCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls", SecurityVersion: "1.2"}
+}
+
+func (c tlsCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (tlsCredentials) OverrideServerName(string) error {
+	return nil
+}
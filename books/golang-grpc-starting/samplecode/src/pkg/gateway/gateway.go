@@ -0,0 +1,388 @@
+// Package gateway provides an HTTP/JSON front end for gRPC services. The
+// routes are derived from the google.api.http annotations in the proto files,
+// so the JSON API follows the proto definitions without hand written handlers.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails" // エラー詳細のAnyを解決できるようにする
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	metadataHeaderPrefix = "Grpc-Metadata-"
+	trailerHeaderPrefix  = "Grpc-Trailer-"
+)
+
+// ForwardedForMetadataKey is the metadata key the gateway forwards the
+// address of the HTTP client in. The value follows the X-Forwarded-For header:
+// the addresses of the request so far, with the peer of the gateway last.
+// PeerUnaryServerInterceptor and PeerStreamServerInterceptor turn it into the
+// peer address of the call.
+const ForwardedForMetadataKey = "x-forwarded-for"
+
+// untrustedMetadata は呼び出し元の識別に使われるので、ゲートウェイ以外が設定した値を信用しないメタデータのキー
+// HTTPクライアントが指定しても転送せず、gRPCの呼び出しからはStripUnaryServerInterceptorで取り除く
+var untrustedMetadata = map[string]bool{
+	ForwardedForMetadataKey: true,
+	"x-client-id":           true,
+}
+
+// Gateway is an http.Handler that transcodes HTTP/JSON requests into gRPC
+// calls on conn.
+type Gateway struct {
+	conn   grpc.ClientConnInterface
+	routes []route
+}
+
+// New builds a Gateway for the annotated methods of services.
+// Methods without a google.api.http option are not exposed.
+// Client and bidirectional streaming methods cannot be annotated.
+func New(conn grpc.ClientConnInterface, services ...protoreflect.ServiceDescriptor) (*Gateway, error) {
+	g := &Gateway{conn: conn}
+	for _, sd := range services {
+		routes, err := routesOf(sd)
+		if err != nil {
+			return nil, err
+		}
+		g.routes = append(g.routes, routes...)
+	}
+	return g, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		matched bool
+		rt      route
+		vars    map[string]string
+	)
+	for _, candidate := range g.routes {
+		v, ok := candidate.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		matched = true
+		if candidate.httpMethod == r.Method {
+			rt, vars = candidate, v
+			break
+		}
+	}
+	switch {
+	case !matched:
+		writeError(w, status.Errorf(codes.NotFound, "no route for %s", r.URL.Path))
+		return
+	case rt.method == nil:
+		writeStatus(w, http.StatusMethodNotAllowed, status.New(codes.Unimplemented, "method not allowed"))
+		return
+	}
+
+	req, err := rt.newRequest(r, vars)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	md := incomingMetadata(r.Header)
+	// 呼び出し先からはゲートウェイが接続元に見えるので、HTTPクライアントのアドレスを渡す
+	if addr := forwardedFor(r); addr != "" {
+		md.Set(ForwardedForMetadataKey, addr)
+	}
+	ctx := metadata.NewOutgoingContext(r.Context(), md)
+	if rt.method.IsStreamingServer() {
+		g.serveStream(ctx, w, r, rt, req)
+		return
+	}
+	g.serveUnary(ctx, w, rt, req)
+}
+
+func (g *Gateway) serveUnary(ctx context.Context, w http.ResponseWriter, rt route, req proto.Message) {
+	res := newMessage(rt.method.Output())
+	var header, trailer metadata.MD
+	err := g.conn.Invoke(ctx, rt.fullMethod, req, res, grpc.Header(&header), grpc.Trailer(&trailer))
+	setMetadataHeaders(w.Header(), metadataHeaderPrefix, header)
+	setMetadataHeaders(w.Header(), trailerHeaderPrefix, trailer)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		writeError(w, status.Error(codes.Internal, err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// serveStream はサーバーストリーミングの応答をNDJSONかServer-Sent Eventsで返す
+func (g *Gateway) serveStream(ctx context.Context, w http.ResponseWriter, r *http.Request, rt route, req proto.Message) {
+	desc := &grpc.StreamDesc{StreamName: string(rt.method.Name()), ServerStreams: true}
+	stream, err := g.conn.NewStream(ctx, desc, rt.fullMethod)
+	if err == nil {
+		err = stream.SendMsg(req)
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// 1件目を受け取るまではHTTPのステータスを確定させない
+	// 引数のバリデーションエラーなどは普通のエラーレスポンスとして返すため
+	first := newMessage(rt.method.Output())
+	err = stream.RecvMsg(first)
+	header, _ := stream.Header()
+	setMetadataHeaders(w.Header(), metadataHeaderPrefix, header)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, err)
+		return
+	}
+
+	enc := newStreamEncoder(w, r)
+	w.WriteHeader(http.StatusOK)
+	for err == nil {
+		if err = enc.result(first); err != nil {
+			return
+		}
+		first = newMessage(rt.method.Output())
+		err = stream.RecvMsg(first)
+	}
+	if !errors.Is(err, io.EOF) {
+		enc.error(err)
+	}
+}
+
+type streamEncoder struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sse     bool
+}
+
+func newStreamEncoder(w http.ResponseWriter, r *http.Request) *streamEncoder {
+	enc := &streamEncoder{w: w}
+	enc.flusher, _ = w.(http.Flusher)
+	enc.sse = strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if enc.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	return enc
+}
+
+func (e *streamEncoder) result(m proto.Message) error {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if e.sse {
+		return e.write("", b)
+	}
+	return e.write("", wrap("result", b))
+}
+
+func (e *streamEncoder) error(err error) error {
+	b, _ := protojson.Marshal(status.Convert(err).Proto())
+	if e.sse {
+		return e.write("error", b)
+	}
+	return e.write("", wrap("error", b))
+}
+
+func (e *streamEncoder) write(event string, data []byte) error {
+	var err error
+	if e.sse {
+		if event != "" {
+			_, err = fmt.Fprintf(e.w, "event: %s\n", event)
+		}
+		if err == nil {
+			_, err = fmt.Fprintf(e.w, "data: %s\n\n", data)
+		}
+	} else {
+		_, err = fmt.Fprintf(e.w, "%s\n", data)
+	}
+	if err == nil && e.flusher != nil {
+		e.flusher.Flush()
+	}
+	return err
+}
+
+func wrap(key string, b []byte) []byte {
+	out, _ := json.Marshal(map[string]json.RawMessage{key: b})
+	return out
+}
+
+// newRequest はボディ、パス変数、クエリパラメータを1つのJSONにまとめてからリクエストメッセージに変換する
+func (rt route) newRequest(r *http.Request, vars map[string]string) (proto.Message, error) {
+	fields := make(map[string]json.RawMessage)
+	if rt.body == "*" && r.Body != nil {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if len(strings.TrimSpace(string(b))) > 0 {
+			if err := json.Unmarshal(b, &fields); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+			}
+		}
+	}
+	input := rt.method.Input()
+	for k, vs := range r.URL.Query() {
+		if err := setField(fields, input, k, vs[len(vs)-1]); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range vars {
+		if err := setField(fields, input, k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	msg := newMessage(input)
+	if err := protojson.Unmarshal(b, msg); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	}
+	return msg, nil
+}
+
+// setField は文字列の値をフィールドの型に合わせたJSONの値にする
+// 数値はprotojsonが文字列表現も受け付けるので、boolだけ特別扱いすればよい
+func setField(fields map[string]json.RawMessage, md protoreflect.MessageDescriptor, name, value string) error {
+	fd := md.Fields().ByJSONName(name)
+	if fd == nil {
+		fd = md.Fields().ByName(protoreflect.Name(name))
+	}
+	if fd == nil {
+		return status.Errorf(codes.InvalidArgument, "unknown field %q", name)
+	}
+
+	if fd.Kind() == protoreflect.BoolKind && (value == "true" || value == "false") {
+		fields[fd.JSONName()] = json.RawMessage(value)
+		return nil
+	}
+	b, _ := json.Marshal(value)
+	fields[fd.JSONName()] = b
+	return nil
+}
+
+// newMessage は生成済みの型があればそれを、なければdynamicpbのメッセージを返す
+func newMessage(md protoreflect.MessageDescriptor) proto.Message {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName())
+	if err != nil {
+		return dynamicpb.NewMessage(md)
+	}
+	return mt.New().Interface()
+}
+
+// incomingMetadata はHTTPヘッダーのうちgRPCに転送するものをメタデータに変換する
+func incomingMetadata(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, vs := range h {
+		switch {
+		case k == "Authorization", k == "Traceparent", k == "X-Request-Id":
+			md.Append(strings.ToLower(k), vs...)
+		case strings.HasPrefix(k, metadataHeaderPrefix):
+			key := strings.ToLower(strings.TrimPrefix(k, metadataHeaderPrefix))
+			if untrustedMetadata[key] {
+				continue
+			}
+			md.Append(key, vs...)
+		}
+	}
+	return md
+}
+
+// forwardedFor はX-Forwarded-Forの値の後ろにrの接続元のアドレスを追加して返す
+func forwardedFor(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addrs := r.Header.Values("X-Forwarded-For")
+	if host != "" {
+		addrs = append(addrs, host)
+	}
+	return strings.Join(addrs, ", ")
+}
+
+func setMetadataHeaders(h http.Header, prefix string, md metadata.MD) {
+	for k, vs := range md {
+		key := textproto.CanonicalMIMEHeaderKey(prefix + k)
+		for _, v := range vs {
+			h.Add(key, v)
+		}
+	}
+}
+
+// writeError はgRPCのステータスをHTTPのステータスに変換して書き出す
+// ボディはgoogle.rpc.StatusのJSONなので、エラー詳細もそのまま返る
+func writeError(w http.ResponseWriter, err error) {
+	stat := status.Convert(err)
+	writeStatus(w, HTTPStatusFromCode(stat.Code()), stat)
+}
+
+func writeStatus(w http.ResponseWriter, httpStatus int, stat *status.Status) {
+	b, merr := protojson.Marshal(stat.Proto())
+	if merr != nil {
+		b = []byte(`{"code":13,"message":"failed to marshal error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	w.Write(b)
+}
+
+// HTTPStatusFromCode returns the HTTP status that corresponds to a gRPC code.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,266 @@
+package gateway_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"mygrpc/internal/grpctest"
+	"mygrpc/pkg/gateway"
+	hellopb "mygrpc/pkg/grpc"
+)
+
+type greetingServer struct {
+	hellopb.UnimplementedGreetingServiceServer
+}
+
+func (s *greetingServer) Hello(ctx context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
+	if req.GetName() == "" {
+		stat, _ := status.New(codes.InvalidArgument, "invalid request").WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name", Description: "name is required"}},
+		})
+		return nil, stat.Err()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs("type", "header"))
+	grpc.SetTrailer(ctx, metadata.Pairs(
+		"from", strings.Join(md.Get("from"), ","),
+		"forwarded-for", strings.Join(md.Get(gateway.ForwardedForMetadataKey), ","),
+		"client-id", strings.Join(md.Get("x-client-id"), ","),
+	))
+	return &hellopb.HelloResponse{Message: fmt.Sprintf("Hello, %s!", req.GetName())}, nil
+}
+
+func (s *greetingServer) HelloServerStream(req *hellopb.HelloRequest, stream hellopb.GreetingService_HelloServerStreamServer) error {
+	if req.GetName() == "fail" {
+		return status.Error(codes.InvalidArgument, "invalid name")
+	}
+	count := int(req.GetCount())
+	if req.Count == nil {
+		count = 2
+	}
+	for i := 0; i < count; i++ {
+		if err := stream.Send(&hellopb.HelloResponse{Message: fmt.Sprintf("[%d] Hello, %s!", i, req.GetName())}); err != nil {
+			return err
+		}
+	}
+	return status.Error(codes.Aborted, "stream aborted")
+}
+
+func newTestGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	_, conn := grpctest.NewGreeting(t, &greetingServer{})
+	gw, err := gateway.New(conn, hellopb.File_hello_proto.Services().ByName("GreetingService"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(gw)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUnary(t *testing.T) {
+	srv := newTestGateway(t)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/hello", strings.NewReader(`{"name":"gopher"}`))
+	req.Header.Set("Grpc-Metadata-From", "gateway")
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	// 呼び出し元の識別に使うメタデータはHTTPクライアントからは指定できない
+	req.Header.Set("Grpc-Metadata-X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("Grpc-Metadata-X-Client-Id", "alice")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", res.StatusCode)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["message"] != "Hello, gopher!" {
+		t.Errorf("message = %q", body["message"])
+	}
+	if got := res.Header.Get("Grpc-Metadata-Type"); got != "header" {
+		t.Errorf("Grpc-Metadata-Type = %q, want header", got)
+	}
+	if got := res.Header.Get("Grpc-Trailer-From"); got != "gateway" {
+		t.Errorf("Grpc-Trailer-From = %q, want gateway", got)
+	}
+	// HTTPクライアントのアドレスがX-Forwarded-Forの後ろに追加される
+	if got := res.Header.Get("Grpc-Trailer-Forwarded-For"); got != "203.0.113.1, 127.0.0.1" {
+		t.Errorf("Grpc-Trailer-Forwarded-For = %q, want 203.0.113.1, 127.0.0.1", got)
+	}
+	if got := res.Header.Get("Grpc-Trailer-Client-Id"); got != "" {
+		t.Errorf("Grpc-Trailer-Client-Id = %q, want empty", got)
+	}
+}
+
+func TestUnaryError(t *testing.T) {
+	srv := newTestGateway(t)
+
+	res, err := http.Post(srv.URL+"/v1/hello", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", res.StatusCode)
+	}
+	var body struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Details []struct {
+			Type            string `json:"@type"`
+			FieldViolations []struct {
+				Field string `json:"field"`
+			} `json:"fieldViolations"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != int(codes.InvalidArgument) {
+		t.Errorf("code = %d, want %d", body.Code, codes.InvalidArgument)
+	}
+	if len(body.Details) != 1 || body.Details[0].Type != "type.googleapis.com/google.rpc.BadRequest" {
+		t.Fatalf("details = %+v, want one BadRequest", body.Details)
+	}
+	if v := body.Details[0].FieldViolations; len(v) != 1 || v[0].Field != "name" {
+		t.Errorf("field violations = %+v", v)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	srv := newTestGateway(t)
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{method: http.MethodGet, path: "/v1/unknown", want: http.StatusNotFound},
+		{method: http.MethodGet, path: "/v1/hello", want: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/v1/hello?unknown=1", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(`{"name":"gopher"}`))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, res.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestServerStreamNDJSON(t *testing.T) {
+	srv := newTestGateway(t)
+
+	// パス変数とクエリパラメータからリクエストを組み立てる
+	res, err := http.Get(srv.URL + "/v1/hello/gopher/stream?count=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var lines []map[string]json.RawMessage
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		var line map[string]json.RawMessage
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4: %s", len(lines), lines)
+	}
+	for i, line := range lines[:3] {
+		want := fmt.Sprintf(`{"message":"[%d] Hello, gopher!"}`, i)
+		if string(line["result"]) != want {
+			t.Errorf("line %d = %s, want %s", i, line["result"], want)
+		}
+	}
+	var stat struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(lines[3]["error"], &stat); err != nil || stat.Code != int(codes.Aborted) {
+		t.Errorf("last line = %s, want an Aborted error", lines[3])
+	}
+}
+
+func TestServerStreamSSE(t *testing.T) {
+	srv := newTestGateway(t)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/hello/stream", strings.NewReader(`{"name":"gopher","count":1}`))
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := strings.Split(strings.TrimSuffix(string(b), "\n\n"), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %q", len(events), b)
+	}
+	var msg map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(events[0], "data: ")), &msg); err != nil || msg["message"] != "[0] Hello, gopher!" {
+		t.Errorf("first event = %q", events[0])
+	}
+	if !strings.HasPrefix(events[1], "event: error\ndata: ") {
+		t.Errorf("last event = %q, want an error event", events[1])
+	}
+}
+
+func TestServerStreamEarlyError(t *testing.T) {
+	srv := newTestGateway(t)
+
+	// 最初のメッセージより前のエラーは通常のエラーレスポンスになる
+	res, err := http.Get(srv.URL + "/v1/hello/fail/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerUnaryServerInterceptor returns an interceptor that replaces the peer address
+// of the call with the HTTP client address forwarded by the Gateway, so that
+// the interceptors after it, such as rate limiting and logging, see the HTTP
+// client instead of the in-process connection.
+//
+// Install it only on the server the Gateway calls in process. On any other
+// server the metadata is sent by the caller and must not be trusted.
+func PeerUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(forwardedPeer(ctx), req)
+	}
+}
+
+// PeerStreamServerInterceptor is the streaming counterpart of
+// PeerUnaryServerInterceptor.
+func PeerStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: forwardedPeer(ss.Context())})
+	}
+}
+
+// StripUnaryServerInterceptor returns an interceptor that removes the metadata
+// used to identify HTTP clients of the Gateway, such as ForwardedForMetadataKey,
+// from the call. Install it on every server so that gRPC callers cannot send
+// it themselves; PeerUnaryServerInterceptor must run before it.
+func StripUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(stripMetadata(ctx), req)
+	}
+}
+
+// StripStreamServerInterceptor is the streaming counterpart of
+// StripUnaryServerInterceptor.
+func StripStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: stripMetadata(ss.Context())})
+	}
+}
+
+func stripMetadata(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	var stripped metadata.MD
+	for k := range untrustedMetadata {
+		if _, ok := md[k]; !ok {
+			continue
+		}
+		if stripped == nil {
+			stripped = md.Copy()
+		}
+		delete(stripped, k)
+	}
+	if stripped == nil {
+		return ctx
+	}
+	return metadata.NewIncomingContext(ctx, stripped)
+}
+
+// forwardedPeer はForwardedForMetadataKeyの最後のアドレスをピアのアドレスにしたコンテキストを返す
+// 最後のアドレスはゲートウェイが直接見た接続元なので、HTTPクライアントには書き換えられない
+func forwardedPeer(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	v := md.Get(ForwardedForMetadataKey)
+	if len(v) == 0 {
+		return ctx
+	}
+	addrs := strings.Split(v[len(v)-1], ",")
+	ip := net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1]))
+	if ip == nil {
+		return ctx
+	}
+	p := &peer.Peer{Addr: &net.TCPAddr{IP: ip}}
+	if orig, ok := peer.FromContext(ctx); ok {
+		p.AuthInfo = orig.AuthInfo
+	}
+	return peer.NewContext(ctx, p)
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
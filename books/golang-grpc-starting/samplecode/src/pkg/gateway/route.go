@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// route はgoogle.api.httpの1つのバインディングに対応する
+type route struct {
+	httpMethod string
+	template   []string // "{name}" の形のセグメントはパス変数
+	body       string
+	method     protoreflect.MethodDescriptor
+	fullMethod string
+}
+
+func routesOf(sd protoreflect.ServiceDescriptor) ([]route, error) {
+	var routes []route
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+		if md.IsStreamingClient() {
+			return nil, fmt.Errorf("gateway: %s: client streaming methods cannot be transcoded", md.FullName())
+		}
+
+		fullMethod := fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())
+		for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			rt, err := newRoute(r, md, fullMethod)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, rt)
+		}
+	}
+	return routes, nil
+}
+
+func newRoute(rule *annotations.HttpRule, md protoreflect.MethodDescriptor, fullMethod string) (route, error) {
+	var httpMethod, path string
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		httpMethod, path = http.MethodGet, p.Get
+	case *annotations.HttpRule_Post:
+		httpMethod, path = http.MethodPost, p.Post
+	case *annotations.HttpRule_Put:
+		httpMethod, path = http.MethodPut, p.Put
+	case *annotations.HttpRule_Patch:
+		httpMethod, path = http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Delete:
+		httpMethod, path = http.MethodDelete, p.Delete
+	default:
+		return route{}, fmt.Errorf("gateway: %s: unsupported http rule %v", md.FullName(), rule)
+	}
+
+	if body := rule.GetBody(); body != "" && body != "*" {
+		return route{}, fmt.Errorf("gateway: %s: only body \"*\" is supported, got %q", md.FullName(), body)
+	}
+
+	template := strings.Split(strings.Trim(path, "/"), "/")
+	for _, seg := range template {
+		name, ok := variable(seg)
+		if !ok {
+			continue
+		}
+		fd := md.Input().Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.Message() != nil || fd.IsList() || fd.IsMap() {
+			return route{}, fmt.Errorf("gateway: %s: path variable %q must be a scalar field of %s", md.FullName(), name, md.Input().FullName())
+		}
+	}
+
+	return route{
+		httpMethod: httpMethod,
+		template:   template,
+		body:       rule.GetBody(),
+		method:     md,
+		fullMethod: fullMethod,
+	}, nil
+}
+
+// match はパスがテンプレートに一致するかを調べ、一致したらパス変数を返す
+func (rt route) match(path string) (map[string]string, bool) {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segs) != len(rt.template) {
+		return nil, false
+	}
+
+	vars := make(map[string]string)
+	for i, seg := range rt.template {
+		if name, ok := variable(seg); ok {
+			vars[name] = segs[i]
+			continue
+		}
+		if seg != segs[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+func variable(seg string) (string, bool) {
+	if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
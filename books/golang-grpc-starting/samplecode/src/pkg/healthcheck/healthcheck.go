@@ -0,0 +1,189 @@
+// Package healthcheck drives the status of a gRPC health server from
+// readiness probes that run periodically.
+package healthcheck
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Probe reports whether a dependency of a service is ready.
+// A non-nil error marks the service NOT_SERVING.
+type Probe func(ctx context.Context) error
+
+type namedProbe struct {
+	name  string
+	probe Probe
+}
+
+// Manager runs the registered probes and updates the health server.
+//
+// Only the registered services are managed. The overall "" service keeps the
+// status of the process itself, so it suits liveness checks while the named
+// services suit readiness checks.
+type Manager struct {
+	srv      *health.Server
+	interval time.Duration
+	timeout  time.Duration
+	logger   *slog.Logger
+
+	mu       sync.Mutex
+	probes   map[string][]namedProbe
+	statuses map[string]healthpb.HealthCheckResponse_ServingStatus
+	shutdown bool
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithInterval sets how often the probes run. The default is 5 seconds.
+func WithInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		m.interval = d
+	}
+}
+
+// WithTimeout sets the deadline of each probe. The default is 1 second.
+func WithTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.timeout = d
+	}
+}
+
+// WithLogger sets the logger status transitions are written to.
+func WithLogger(l *slog.Logger) Option {
+	return func(m *Manager) {
+		m.logger = l
+	}
+}
+
+// NewManager returns a Manager that updates srv.
+func NewManager(srv *health.Server, opts ...Option) *Manager {
+	m := &Manager{
+		srv:      srv,
+		interval: 5 * time.Second,
+		timeout:  time.Second,
+		logger:   slog.Default(),
+		probes:   make(map[string][]namedProbe),
+		statuses: make(map[string]healthpb.HealthCheckResponse_ServingStatus),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Register adds a probe to service. The service is NOT_SERVING until all of
+// its probes have passed once.
+func (m *Manager) Register(service, name string, p Probe) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.probes[service] = append(m.probes[service], namedProbe{name: name, probe: p})
+	m.setLocked(service, healthpb.HealthCheckResponse_NOT_SERVING, "")
+}
+
+// Run checks all services immediately and then every interval until ctx is done.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.CheckNow(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckNow runs the probes of every service once and updates their statuses.
+func (m *Manager) CheckNow(ctx context.Context) {
+	m.mu.Lock()
+	probes := make(map[string][]namedProbe, len(m.probes))
+	for svc, ps := range m.probes {
+		probes[svc] = append([]namedProbe(nil), ps...)
+	}
+	m.mu.Unlock()
+
+	for svc, ps := range probes {
+		st, reason := healthpb.HealthCheckResponse_SERVING, ""
+		for _, p := range ps {
+			if err := m.runProbe(ctx, p.probe); err != nil {
+				st, reason = healthpb.HealthCheckResponse_NOT_SERVING, p.name+": "+err.Error()
+				break
+			}
+		}
+
+		m.mu.Lock()
+		m.setLocked(svc, st, reason)
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) runProbe(ctx context.Context, p Probe) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	return p(ctx)
+}
+
+// Shutdown marks every service, including "", NOT_SERVING for good.
+// Call it as soon as the server starts to stop, so that load balancers
+// drain the traffic before the connections are closed.
+func (m *Manager) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shutdown = true
+	m.srv.Shutdown()
+	m.logger.Info("health: all services are NOT_SERVING for shutdown")
+}
+
+// ServeHTTP reports the status of the service named by the "service" query
+// parameter to HTTP health checkers that cannot speak gRPC, such as load
+// balancers without gRPC support. It responds 200 for SERVING, 404 for an
+// unknown service and 503 otherwise.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res, err := m.srv.Check(r.Context(), &healthpb.HealthCheckRequest{Service: r.URL.Query().Get("service")})
+	if err != nil {
+		http.Error(w, "unknown service", http.StatusNotFound)
+		return
+	}
+
+	st := res.GetStatus()
+	code := http.StatusOK
+	if st != healthpb.HealthCheckResponse_SERVING {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write([]byte(st.String() + "\n"))
+}
+
+func (m *Manager) setLocked(service string, st healthpb.HealthCheckResponse_ServingStatus, reason string) {
+	if m.shutdown {
+		return
+	}
+	prev, ok := m.statuses[service]
+	if ok && prev == st {
+		return
+	}
+	m.statuses[service] = st
+	m.srv.SetServingStatus(service, st)
+
+	if ok {
+		m.logger.Info("health: status changed",
+			slog.String("service", service),
+			slog.String("from", prev.String()),
+			slog.String("to", st.String()),
+			slog.String("reason", reason),
+		)
+	}
+}
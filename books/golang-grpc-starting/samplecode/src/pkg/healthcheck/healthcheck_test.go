@@ -0,0 +1,134 @@
+package healthcheck_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"mygrpc/internal/grpctest"
+	"mygrpc/pkg/healthcheck"
+)
+
+func TestManager(t *testing.T) {
+	healthSrv := health.NewServer()
+	s := grpctest.NewServer(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, healthSrv)
+	})
+	client := healthpb.NewHealthClient(s.Dial(t))
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	mgr := healthcheck.NewManager(healthSrv, healthcheck.WithInterval(10*time.Millisecond))
+	mgr.Register("mygrpc", "db", func(ctx context.Context) error {
+		if !healthy.Load() {
+			return errors.New("db is down")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	watch, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "mygrpc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+		res, err := watch.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.GetStatus()
+	}
+
+	// 最初のプローブが通るまではNOT_SERVING
+	if got := next(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("initial status = %s, want NOT_SERVING", got)
+	}
+
+	runCtx, stopRun := context.WithCancel(ctx)
+	defer stopRun()
+	go mgr.Run(runCtx)
+
+	if got := next(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("status = %s, want SERVING", got)
+	}
+	healthy.Store(false)
+	if got := next(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("status = %s, want NOT_SERVING", got)
+	}
+	healthy.Store(true)
+	if got := next(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("status = %s, want SERVING", got)
+	}
+
+	// 全体("")はプローブの影響を受けない
+	res, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("overall status = %s, want SERVING", res.GetStatus())
+	}
+
+	mgr.Shutdown()
+	if got := next(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("status after Shutdown = %s, want NOT_SERVING", got)
+	}
+	res, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("overall status after Shutdown = %s, want NOT_SERVING", res.GetStatus())
+	}
+
+	// シャットダウン後はプローブが通ってもSERVINGに戻らない
+	mgr.CheckNow(ctx)
+	res, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "mygrpc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status after CheckNow = %s, want NOT_SERVING", res.GetStatus())
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	healthSrv := health.NewServer()
+	mgr := healthcheck.NewManager(healthSrv)
+	mgr.Register("mygrpc", "db", func(context.Context) error { return nil })
+
+	get := func(target string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mgr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+
+	if got := get("/healthz"); got != http.StatusOK {
+		t.Errorf("overall: status = %d, want 200", got)
+	}
+	if got := get("/healthz?service=mygrpc"); got != http.StatusServiceUnavailable {
+		t.Errorf("before probes: status = %d, want 503", got)
+	}
+	mgr.CheckNow(context.Background())
+	if got := get("/healthz?service=mygrpc"); got != http.StatusOK {
+		t.Errorf("after probes: status = %d, want 200", got)
+	}
+	if got := get("/healthz?service=unknown"); got != http.StatusNotFound {
+		t.Errorf("unknown service: status = %d, want 404", got)
+	}
+	mgr.Shutdown()
+	if got := get("/healthz"); got != http.StatusServiceUnavailable {
+		t.Errorf("after Shutdown: status = %d, want 503", got)
+	}
+}
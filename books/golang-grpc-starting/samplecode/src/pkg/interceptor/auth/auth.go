@@ -0,0 +1,162 @@
+// Package auth provides gRPC interceptors that authenticate calls with a
+// bearer token in the "authorization" metadata, and the matching client
+// credentials.
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrPermissionDenied can be returned (or wrapped) by a TokenVerifier to
+// reject a valid token with codes.PermissionDenied instead of Unauthenticated.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string
+}
+
+// TokenVerifier validates a bearer token and returns its principal.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*Principal, error)
+}
+
+// Authorizer decides whether the principal may call the method.
+type Authorizer func(ctx context.Context, p *Principal, fullMethod string) bool
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx that carries p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx by the interceptors.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+type options struct {
+	publicMethods []string
+	authorizer    Authorizer
+}
+
+// Option configures the interceptors.
+type Option func(*options)
+
+// WithPublicMethods lets calls to the given methods through without a token.
+// An entry ending with "/" (e.g. "/grpc.health.v1.Health/") matches every
+// method of the service; otherwise the full method name must match exactly.
+func WithPublicMethods(methods ...string) Option {
+	return func(o *options) {
+		o.publicMethods = append(o.publicMethods, methods...)
+	}
+}
+
+// WithAuthorizer sets an Authorizer that is consulted after the token is
+// verified. Calls it rejects fail with codes.PermissionDenied.
+func WithAuthorizer(a Authorizer) Option {
+	return func(o *options) {
+		o.authorizer = a
+	}
+}
+
+func (o *options) isPublic(fullMethod string) bool {
+	for _, m := range o.publicMethods {
+		if m == fullMethod || (strings.HasSuffix(m, "/") && strings.HasPrefix(fullMethod, m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor returns an interceptor that authenticates unary RPCs.
+func UnaryServerInterceptor(v TokenVerifier, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := o.authenticate(ctx, v, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that authenticates streaming RPCs.
+func StreamServerInterceptor(v TokenVerifier, opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := o.authenticate(ss.Context(), v, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// serverStream はハンドラに認証済みのcontextを渡すためのラッパー
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (o *options) authenticate(ctx context.Context, v TokenVerifier, fullMethod string) (context.Context, error) {
+	if o.isPublic(fullMethod) {
+		return ctx, nil
+	}
+
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := v.Verify(ctx, token)
+	switch {
+	case errors.Is(err, ErrPermissionDenied):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if o.authorizer != nil && !o.authorizer(ctx, p, fullMethod) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not allowed to call %s", p.Subject, fullMethod)
+	}
+	return NewContext(ctx, p), nil
+}
+
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "authorization metadata is missing")
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", status.Error(codes.Unauthenticated, "authorization metadata must be a bearer token")
+	}
+	return token, nil
+}
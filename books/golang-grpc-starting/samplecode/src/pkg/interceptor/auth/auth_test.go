@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"mygrpc/internal/grpctest"
+	"mygrpc/pkg/interceptor/auth"
+)
+
+type verifier struct{}
+
+func (verifier) Verify(_ context.Context, token string) (*auth.Principal, error) {
+	switch token {
+	case "valid":
+		return &auth.Principal{Subject: "alice"}, nil
+	case "banned":
+		return nil, fmt.Errorf("banned user: %w", auth.ErrPermissionDenied)
+	default:
+		return nil, fmt.Errorf("unknown token")
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	var gotPrincipal *auth.Principal
+	record := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		gotPrincipal, _ = auth.FromContext(ctx)
+		return handler(ctx, req)
+	}
+	onlyAlice := auth.WithAuthorizer(func(_ context.Context, p *auth.Principal, method string) bool {
+		return p.Subject == "alice"
+	})
+
+	s := grpctest.NewServer(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, health.NewServer())
+	},
+		grpc.ChainUnaryInterceptor(
+			auth.UnaryServerInterceptor(verifier{}, onlyAlice, auth.WithPublicMethods("/grpc.health.v1.Health/Watch")),
+			record,
+		),
+		grpc.ChainStreamInterceptor(
+			auth.StreamServerInterceptor(verifier{}, onlyAlice, auth.WithPublicMethods("/grpc.health.v1.Health/Watch")),
+		),
+	)
+
+	dial := func(t *testing.T, opts ...grpc.DialOption) healthpb.HealthClient {
+		t.Helper()
+		return healthpb.NewHealthClient(s.Dial(t, opts...))
+	}
+
+	tests := []struct {
+		name     string
+		opts     []grpc.DialOption
+		md       metadata.MD
+		wantCode codes.Code
+	}{
+		{
+			name:     "valid token via PerRPCCredentials",
+			opts:     []grpc.DialOption{grpc.WithPerRPCCredentials(auth.NewTokenCredentials("valid", false))},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "missing token",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "not a bearer token",
+			md:       metadata.Pairs("authorization", "Basic dXNlcjpwYXNz"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "unknown token",
+			md:       metadata.Pairs("authorization", "Bearer invalid"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "permission denied by verifier",
+			md:       metadata.Pairs("authorization", "Bearer banned"),
+			wantCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPrincipal = nil
+			client := dial(t, tt.opts...)
+			ctx := metadata.NewOutgoingContext(context.Background(), tt.md)
+
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("Check() code = %s, want %s (%v)", got, tt.wantCode, err)
+			}
+			if tt.wantCode == codes.OK && (gotPrincipal == nil || gotPrincipal.Subject != "alice") {
+				t.Errorf("principal = %v, want alice", gotPrincipal)
+			}
+		})
+	}
+
+	t.Run("public stream method", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := dial(t).Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Errorf("Watch() without token: %v", err)
+		}
+	})
+}
+
+func TestAuthorizer(t *testing.T) {
+	interceptor := auth.UnaryServerInterceptor(verifier{}, auth.WithAuthorizer(
+		func(_ context.Context, p *auth.Principal, method string) bool {
+			return method != "/admin"
+		},
+	))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer valid"))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	if _, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/hello"}, handler); err != nil {
+		t.Errorf("allowed method: %v", err)
+	}
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/admin"}, handler)
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("denied method code = %s, want PermissionDenied", got)
+	}
+}
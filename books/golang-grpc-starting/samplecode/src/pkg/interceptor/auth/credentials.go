@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TokenCredentials attaches a bearer token to every RPC.
+// It implements credentials.PerRPCCredentials.
+type TokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+var _ credentials.PerRPCCredentials = (*TokenCredentials)(nil)
+
+// NewTokenCredentials returns credentials that send token as a bearer token.
+// If requireTLS is true, the token is never sent over a plaintext connection.
+func NewTokenCredentials(token string, requireTLS bool) *TokenCredentials {
+	return &TokenCredentials{token: token, requireTLS: requireTLS}
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c *TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c *TokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
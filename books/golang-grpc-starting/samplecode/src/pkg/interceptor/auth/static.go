@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// StaticTokens is a TokenVerifier backed by a fixed token-to-subject table.
+type StaticTokens map[string]string
+
+var _ TokenVerifier = StaticTokens(nil)
+
+// Verify implements TokenVerifier.
+func (s StaticTokens) Verify(_ context.Context, token string) (*Principal, error) {
+	subject, ok := s[token]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return &Principal{Subject: subject}, nil
+}
+
+// LoadStaticTokens reads a file that has one "<token> <subject>" pair per line.
+// Empty lines and lines starting with "#" are ignored.
+func LoadStaticTokens(path string) (StaticTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := StaticTokens{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"<token> <subject>\"", path, n)
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	return tokens, sc.Err()
+}
@@ -0,0 +1,168 @@
+// Package logging provides gRPC server interceptors that emit one structured
+// log/slog record per RPC.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const redacted = "[REDACTED]"
+
+// DefaultRedactedKeys are the metadata keys whose values are never logged
+// unless WithRedactedKeys overrides them.
+var DefaultRedactedKeys = []string{"authorization", "cookie"}
+
+type options struct {
+	logger       *slog.Logger
+	redactedKeys map[string]struct{}
+}
+
+// Option configures the interceptors.
+type Option func(*options)
+
+// WithLogger sets the logger the records are written to.
+// slog.Default() is used if it is not specified.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithRedactedKeys replaces the list of metadata keys whose values are
+// replaced with "[REDACTED]".
+func WithRedactedKeys(keys ...string) Option {
+	return func(o *options) {
+		o.redactedKeys = make(map[string]struct{}, len(keys))
+		for _, k := range keys {
+			o.redactedKeys[strings.ToLower(k)] = struct{}{}
+		}
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{logger: slog.Default()}
+	WithRedactedKeys(DefaultRedactedKeys...)(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// UnaryServerInterceptor returns an interceptor that logs every unary RPC.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		res, err := handler(ctx, req) // 本来の処理
+		o.log(ctx, info.FullMethod, start, err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that logs every streaming RPC
+// together with the number of messages received and sent.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		wrapped := &serverStream{ServerStream: ss}
+		err := handler(srv, wrapped) // 本来のストリーム処理
+		o.log(ss.Context(), info.FullMethod, start, err,
+			slog.Int64("grpc.recv_msgs", wrapped.recv.Load()),
+			slog.Int64("grpc.sent_msgs", wrapped.sent.Load()),
+		)
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	recv atomic.Int64
+	sent atomic.Int64
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.recv.Add(1)
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
+
+func (o *options) log(ctx context.Context, method string, start time.Time, err error, extra ...slog.Attr) {
+	code := status.Code(err)
+
+	attrs := []slog.Attr{
+		slog.String("grpc.method", method),
+		slog.String("grpc.peer", peerAddr(ctx)),
+		slog.String("grpc.code", code.String()),
+		slog.Duration("grpc.duration", time.Since(start)),
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		attrs = append(attrs, o.metadataAttr(md))
+	}
+	attrs = append(attrs, extra...)
+	if err != nil {
+		attrs = append(attrs, slog.String("grpc.error", status.Convert(err).Message()))
+	}
+
+	o.logger.LogAttrs(ctx, level(code), "finished call", attrs...)
+}
+
+func (o *options) metadataAttr(md metadata.MD) slog.Attr {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]any, 0, len(keys))
+	for _, k := range keys {
+		if _, ok := o.redactedKeys[k]; ok {
+			attrs = append(attrs, slog.String(k, redacted))
+			continue
+		}
+		attrs = append(attrs, slog.String(k, strings.Join(md[k], ",")))
+	}
+	return slog.Group("grpc.metadata", attrs...)
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// level はステータスコードに応じたログレベルを決める
+func level(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK, codes.Canceled, codes.NotFound, codes.AlreadyExists:
+		return slog.LevelInfo
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange,
+		codes.Unauthenticated, codes.PermissionDenied, codes.ResourceExhausted,
+		codes.DeadlineExceeded, codes.Aborted:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
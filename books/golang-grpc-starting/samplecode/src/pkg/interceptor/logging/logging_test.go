@@ -0,0 +1,101 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"mygrpc/internal/grpctest"
+	"mygrpc/pkg/interceptor/logging"
+)
+
+func TestInterceptors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	s := grpctest.NewServer(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, health.NewServer())
+	},
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(logging.WithLogger(logger))),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(logging.WithLogger(logger))),
+	)
+	client := healthpb.NewHealthClient(s.Dial(t))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret", "from", "client")
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"}); err == nil {
+		t.Fatal("expected NotFound error")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	s.GracefulStop()
+
+	var records []map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r map[string]any
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3: %v", len(records), records)
+	}
+
+	tests := []struct {
+		method string
+		code   string
+		level  string
+	}{
+		{method: "/grpc.health.v1.Health/Check", code: "OK", level: "INFO"},
+		{method: "/grpc.health.v1.Health/Check", code: "NotFound", level: "INFO"},
+		{method: "/grpc.health.v1.Health/Watch", code: "Canceled", level: "INFO"},
+	}
+	for i, tt := range tests {
+		r := records[i]
+		if r["grpc.method"] != tt.method {
+			t.Errorf("record %d: method = %v, want %v", i, r["grpc.method"], tt.method)
+		}
+		if r["grpc.code"] != tt.code {
+			t.Errorf("record %d: code = %v, want %v", i, r["grpc.code"], tt.code)
+		}
+		if r["level"] != tt.level {
+			t.Errorf("record %d: level = %v, want %v", i, r["level"], tt.level)
+		}
+		if r["grpc.peer"] == "" {
+			t.Errorf("record %d: peer is empty", i)
+		}
+		md, _ := r["grpc.metadata"].(map[string]any)
+		if md["authorization"] != "[REDACTED]" {
+			t.Errorf("record %d: authorization = %v, want redacted", i, md["authorization"])
+		}
+		if md["from"] != "client" {
+			t.Errorf("record %d: from = %v, want client", i, md["from"])
+		}
+	}
+
+	if got := records[2]["grpc.sent_msgs"]; got != float64(1) {
+		t.Errorf("sent_msgs = %v, want 1", got)
+	}
+	if got := records[2]["grpc.recv_msgs"]; got != float64(1) {
+		t.Errorf("recv_msgs = %v, want 1", got)
+	}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// bucket はトークンバケット
+// ロックは呼び出し側(Limiter)で取る
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(l Limit, now time.Time) *bucket {
+	return &bucket{
+		rate:   l.Rate,
+		burst:  float64(l.Burst),
+		tokens: float64(l.Burst),
+		last:   now,
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	b.last = now
+}
+
+// take はトークンを1つ取り出す
+// 取り出せなかった場合は、次のトークンが補充されるまでの時間を返す
+func (b *bucket) take(now time.Time) (ok bool, retryAfter time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
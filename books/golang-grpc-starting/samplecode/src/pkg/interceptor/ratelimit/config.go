@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Limit is the limit applied to one method.
+type Limit struct {
+	// Rate is the number of request messages per second each caller may send.
+	// Zero means unlimited.
+	Rate float64 `json:"rate"`
+	// Burst is the bucket size. It defaults to 1 when Rate is set.
+	Burst int `json:"burst"`
+	// MaxConcurrentStreams caps the number of streams of the method open at
+	// the same time across all callers. Zero means unlimited.
+	MaxConcurrentStreams int `json:"maxConcurrentStreams"`
+}
+
+// Config is the set of limits. Methods are keyed by full method name
+// (e.g. "/myapp.GreetingService/HelloBiStreams"); Default applies to the rest.
+type Config struct {
+	Default Limit            `json:"default"`
+	Methods map[string]Limit `json:"methods"`
+}
+
+// LoadConfig reads a JSON encoded Config from path.
+func LoadConfig(path string) (Config, error) {
+	var c Config
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("ratelimit: parse %s: %w", path, err)
+	}
+	return c, c.Validate()
+}
+
+// Validate reports an error if any limit is negative.
+func (c Config) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("ratelimit: default: %w", err)
+	}
+	for m, l := range c.Methods {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("ratelimit: %s: %w", m, err)
+		}
+	}
+	return nil
+}
+
+func (l Limit) validate() error {
+	if l.Rate < 0 || l.Burst < 0 || l.MaxConcurrentStreams < 0 {
+		return fmt.Errorf("limits must not be negative: %+v", l)
+	}
+	return nil
+}
+
+func (c Config) limitFor(fullMethod string) Limit {
+	l, ok := c.Methods[fullMethod]
+	if !ok {
+		l = c.Default
+	}
+	if l.Rate > 0 && l.Burst == 0 {
+		l.Burst = 1
+	}
+	return l
+}
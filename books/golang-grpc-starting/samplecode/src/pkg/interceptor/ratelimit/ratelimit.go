@@ -0,0 +1,264 @@
+// Package ratelimit provides gRPC server interceptors that limit the request
+// rate per method and caller with token buckets, and the number of concurrent
+// streams per method.
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"mygrpc/pkg/interceptor/auth"
+	"mygrpc/pkg/metrics"
+)
+
+const (
+	// 同時接続数の上限に達したときにクライアントに提示する再試行までの時間
+	concurrencyRetryDelay = time.Second
+	// 使われなくなったバケットを掃除する間隔
+	pruneInterval = time.Minute
+)
+
+// Counts is the number of request messages handled for one method.
+type Counts struct {
+	Allowed            uint64
+	RateLimited        uint64
+	ConcurrencyLimited uint64
+}
+
+type bucketKey struct {
+	method   string
+	identity string
+}
+
+// Limiter holds the state of the limits. Create it with New and install
+// both of its interceptors on the server.
+type Limiter struct {
+	conf        Config
+	identityKey string
+	counter     *metrics.CounterVec
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	streams   map[string]int
+	counts    map[string]*Counts
+	lastPrune time.Time
+}
+
+// Option configures a Limiter.
+type Option func(*Limiter)
+
+// WithIdentityMetadataKey sets the metadata key that identifies the caller
+// when the call is not authenticated. The peer IP address is used if the key
+// is absent. Authenticated calls are always identified by their principal.
+//
+// The key is not used by default. Any caller can send a new value on every
+// call to get a fresh bucket, so set it only when a trusted proxy in front of
+// the server sets the key and removes the value sent by the client.
+func WithIdentityMetadataKey(key string) Option {
+	return func(l *Limiter) {
+		l.identityKey = key
+	}
+}
+
+// WithCounter also counts the handled request messages in c, which must have
+// the labels grpc_method and result. The result is one of "allowed",
+// "rate_limited" and "concurrency_limited", the same as the fields of Counts.
+func WithCounter(c *metrics.CounterVec) Option {
+	return func(l *Limiter) {
+		l.counter = c
+	}
+}
+
+// New returns a Limiter that enforces conf.
+func New(conf Config, opts ...Option) *Limiter {
+	l := &Limiter{
+		conf:    conf,
+		buckets: make(map[bucketKey]*bucket),
+		streams: make(map[string]int),
+		counts:  make(map[string]*Counts),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.lastPrune = time.Now()
+	return l
+}
+
+// Counters returns a snapshot of the counts per full method name.
+func (l *Limiter) Counters() map[string]Counts {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counters := make(map[string]Counts, len(l.counts))
+	for m, c := range l.counts {
+		counters[m] = *c
+	}
+	return counters
+}
+
+// UnaryServerInterceptor returns an interceptor that takes one token per call.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that rejects streams over
+// the concurrency limit and takes one token per received message, so a
+// client cannot flood a long-lived stream either.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		release, err := l.acquireStream(info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		return handler(srv, &serverStream{ServerStream: ss, limiter: l, method: info.FullMethod})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	limiter *Limiter
+	method  string
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	// 受信できたメッセージにだけトークンを使う
+	// 先に使うと、burst個送って半分閉じたクライアントの最後のio.EOFまで制限されてしまう
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.limiter.allow(s.Context(), s.method)
+}
+
+func (l *Limiter) allow(ctx context.Context, method string) error {
+	limit := l.conf.limitFor(method)
+	identity := l.identity(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	if limit.Rate == 0 {
+		l.count(method, resultAllowed)
+		return nil
+	}
+
+	key := bucketKey{method: method, identity: identity}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBucket(limit, now)
+		l.buckets[key] = b
+	}
+	ok, retryAfter := b.take(now)
+	if !ok {
+		l.count(method, resultRateLimited)
+		return exhausted("rate limit exceeded for "+method, retryAfter)
+	}
+	l.count(method, resultAllowed)
+	return nil
+}
+
+func (l *Limiter) acquireStream(method string) (release func(), err error) {
+	limit := l.conf.limitFor(method)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit.MaxConcurrentStreams > 0 && l.streams[method] >= limit.MaxConcurrentStreams {
+		l.count(method, resultConcurrencyLimited)
+		return nil, exhausted("too many concurrent streams for "+method, concurrencyRetryDelay)
+	}
+	l.streams[method]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.streams[method]--
+	}, nil
+}
+
+// WithCounterに記録するresultラベルの値
+const (
+	resultAllowed            = "allowed"
+	resultRateLimited        = "rate_limited"
+	resultConcurrencyLimited = "concurrency_limited"
+)
+
+// count はl.muを持った状態で呼ぶ
+func (l *Limiter) count(method, result string) {
+	c, ok := l.counts[method]
+	if !ok {
+		c = &Counts{}
+		l.counts[method] = c
+	}
+	switch result {
+	case resultAllowed:
+		c.Allowed++
+	case resultRateLimited:
+		c.RateLimited++
+	case resultConcurrencyLimited:
+		c.ConcurrencyLimited++
+	}
+	if l.counter != nil {
+		l.counter.With(method, result).Inc()
+	}
+}
+
+// prune は満タンになったバケットを削除する
+// 満タンのバケットは新しく作り直したものと区別がつかないので、消しても挙動は変わらない
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for k, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// identity は呼び出し元を識別する文字列を返す
+// 認証済みならプリンシパル、次に設定されたメタデータ、最後にピアのIPアドレスの順で使う
+func (l *Limiter) identity(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return "principal:" + p.Subject
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && l.identityKey != "" {
+		if v := md.Get(l.identityKey); len(v) > 0 {
+			return "metadata:" + v[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "peer:" + host
+	}
+	return ""
+}
+
+func exhausted(msg string, retryAfter time.Duration) error {
+	stat := status.New(codes.ResourceExhausted, msg)
+	if withDetails, err := stat.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		stat = withDetails
+	}
+	return stat.Err()
+}
@@ -0,0 +1,256 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"mygrpc/internal/grpctest"
+	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/interceptor/ratelimit"
+	"mygrpc/pkg/metrics"
+)
+
+const (
+	checkMethod        = "/grpc.health.v1.Health/Check"
+	watchMethod        = "/grpc.health.v1.Health/Watch"
+	clientStreamMethod = "/myapp.GreetingService/HelloClientStream"
+)
+
+// greetingServer は受け取った名前の数を返す
+type greetingServer struct {
+	hellopb.UnimplementedGreetingServiceServer
+}
+
+func (greetingServer) HelloClientStream(stream hellopb.GreetingService_HelloClientStreamServer) error {
+	n := 0
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&hellopb.HelloResponse{Message: fmt.Sprint(n)})
+		}
+		if err != nil {
+			return err
+		}
+		n++
+	}
+}
+
+func newClient(t *testing.T, l *ratelimit.Limiter) healthpb.HealthClient {
+	t.Helper()
+	return healthpb.NewHealthClient(newConn(t, l))
+}
+
+func newConn(t *testing.T, l *ratelimit.Limiter) *grpc.ClientConn {
+	t.Helper()
+
+	s := grpctest.NewServer(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, health.NewServer())
+		hellopb.RegisterGreetingServiceServer(s, greetingServer{})
+	}, grpc.ChainUnaryInterceptor(l.UnaryServerInterceptor()), grpc.ChainStreamInterceptor(l.StreamServerInterceptor()))
+	return s.Dial(t)
+}
+
+func withClientID(id string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-client-id", id)
+}
+
+func TestRateLimit(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{
+		Methods: map[string]ratelimit.Limit{
+			// 補充はテスト中に起きないくらい遅くする
+			checkMethod: {Rate: 0.001, Burst: 2},
+		},
+	}, ratelimit.WithIdentityMetadataKey("x-client-id"))
+	client := newClient(t, l)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Check(withClientID("alice"), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+
+	_, err := client.Check(withClientID("alice"), &healthpb.HealthCheckRequest{})
+	stat := status.Convert(err)
+	if stat.Code() != codes.ResourceExhausted {
+		t.Fatalf("code = %s, want ResourceExhausted", stat.Code())
+	}
+	if len(stat.Details()) != 1 {
+		t.Fatalf("got %d details, want 1", len(stat.Details()))
+	}
+	info, ok := stat.Details()[0].(*errdetails.RetryInfo)
+	if !ok {
+		t.Fatalf("detail type = %T, want *errdetails.RetryInfo", stat.Details()[0])
+	}
+	if d := info.GetRetryDelay().AsDuration(); d <= 0 || d > 1000*time.Second {
+		t.Errorf("retry delay = %s, want (0, 1000s]", d)
+	}
+
+	// 別の呼び出し元は自分のバケットを持つ
+	if _, err := client.Check(withClientID("bob"), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("other caller: %v", err)
+	}
+
+	got := l.Counters()[checkMethod]
+	want := ratelimit.Counts{Allowed: 3, RateLimited: 1}
+	if got != want {
+		t.Errorf("counters = %+v, want %+v", got, want)
+	}
+}
+
+func TestRotatingIdentity(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{
+		Methods: map[string]ratelimit.Limit{
+			checkMethod: {Rate: 0.001, Burst: 2},
+		},
+	})
+	client := newClient(t, l)
+
+	// メタデータのキーを設定していなければ、x-client-idを毎回変えても同じピアとして制限される
+	for i := 0; i < 2; i++ {
+		if _, err := client.Check(withClientID(fmt.Sprint("client-", i)), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	_, err := client.Check(withClientID("client-2"), &healthpb.HealthCheckRequest{})
+	if code := status.Code(err); code != codes.ResourceExhausted {
+		t.Fatalf("code = %s, want ResourceExhausted", code)
+	}
+}
+
+func TestStreamMessages(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counter := registry.NewCounterVec("requests_total", "", "grpc_method", "result")
+	l := ratelimit.New(ratelimit.Config{
+		Methods: map[string]ratelimit.Limit{
+			clientStreamMethod: {Rate: 0.001, Burst: 3},
+		},
+	}, ratelimit.WithIdentityMetadataKey("x-client-id"), ratelimit.WithCounter(counter))
+	client := hellopb.NewGreetingServiceClient(newConn(t, l))
+
+	send := func(id string, n int) (*hellopb.HelloResponse, error) {
+		stream, err := client.HelloClientStream(withClientID(id))
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			if err := stream.Send(&hellopb.HelloRequest{Name: fmt.Sprint(i)}); err != nil {
+				break
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+
+	// burstちょうどのメッセージを送って閉じるだけなら、最後のio.EOFで制限されない
+	res, err := send("alice", 3)
+	if err != nil {
+		t.Fatalf("burst messages: %v", err)
+	}
+	if res.GetMessage() != "3" {
+		t.Errorf("received %s messages, want 3", res.GetMessage())
+	}
+
+	if _, err := send("bob", 4); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("code = %s, want ResourceExhausted", status.Code(err))
+	}
+
+	if got := counter.With(clientStreamMethod, "allowed").Value(); got != 6 {
+		t.Errorf("allowed = %v, want 6", got)
+	}
+	if got := counter.With(clientStreamMethod, "rate_limited").Value(); got != 1 {
+		t.Errorf("rate_limited = %v, want 1", got)
+	}
+	want := ratelimit.Counts{Allowed: 6, RateLimited: 1}
+	if got := l.Counters()[clientStreamMethod]; got != want {
+		t.Errorf("counters = %+v, want %+v", got, want)
+	}
+}
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{
+		Methods: map[string]ratelimit.Limit{
+			watchMethod: {MaxConcurrentStreams: 1},
+		},
+	})
+	client := newClient(t, l)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second stream: code = %s, want ResourceExhausted", status.Code(err))
+	}
+
+	// 1本目を閉じれば再び開ける
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		third, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = third.Recv()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream was not released: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := l.Counters()[watchMethod].ConcurrencyLimited; got == 0 {
+		t.Error("ConcurrencyLimited counter was not incremented")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	if err := os.WriteFile(path, []byte(`{
+		"default": {"rate": 10, "burst": 20},
+		"methods": {"/myapp.GreetingService/HelloBiStreams": {"rate": 1, "maxConcurrentStreams": 4}}
+	}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := ratelimit.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Default != (ratelimit.Limit{Rate: 10, Burst: 20}) {
+		t.Errorf("default = %+v", conf.Default)
+	}
+	if got := conf.Methods["/myapp.GreetingService/HelloBiStreams"]; got != (ratelimit.Limit{Rate: 1, MaxConcurrentStreams: 4}) {
+		t.Errorf("HelloBiStreams = %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"default": {"rate": -1}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ratelimit.LoadConfig(path); err == nil {
+		t.Error("expected validation error for negative rate")
+	}
+}
@@ -0,0 +1,115 @@
+// Package recovery provides gRPC server interceptors that turn a panic in a
+// handler into a codes.Internal error instead of crashing the process.
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mygrpc/pkg/metrics"
+)
+
+type options struct {
+	logger  *slog.Logger
+	debug   bool
+	counter *metrics.CounterVec
+}
+
+// Option configures the interceptors.
+type Option func(*options)
+
+// WithLogger sets the logger the panics are written to.
+// slog.Default() is used if it is not specified. The logs are written with
+// the context of the call, so a handler such as tracing.LogHandler can add
+// the request ID.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithDebug attaches a DebugInfo detail with the panic value and the stack
+// trace to the returned status. Enable it only where the clients are trusted.
+func WithDebug(enabled bool) Option {
+	return func(o *options) {
+		o.debug = enabled
+	}
+}
+
+// WithPanicCounter counts the recovered panics in c, which must have a single
+// grpc_method label.
+func WithPanicCounter(c *metrics.CounterVec) Option {
+	return func(o *options) {
+		o.counter = c
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// UnaryServerInterceptor returns an interceptor that recovers from panics in
+// unary handlers.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				res, err = nil, o.recovered(ctx, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that recovers from panics in
+// streaming handlers.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = o.recovered(ss.Context(), info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+func (o *options) recovered(ctx context.Context, method string, p interface{}) error {
+	stack := debug.Stack()
+
+	if o.counter != nil {
+		o.counter.With(method).Inc()
+	}
+	o.logger.LogAttrs(ctx, slog.LevelError, "recovered from panic",
+		slog.String("grpc.method", method),
+		slog.String("panic", fmt.Sprint(p)),
+		slog.String("stack", string(stack)),
+	)
+
+	stat := status.New(codes.Internal, "internal error")
+	if !o.debug {
+		return stat.Err()
+	}
+	detailed, err := stat.WithDetails(&errdetails.DebugInfo{
+		StackEntries: strings.Split(strings.TrimSpace(string(stack)), "\n"),
+		Detail:       fmt.Sprintf("panic: %v", p),
+	})
+	if err != nil {
+		return stat.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,133 @@
+package recovery_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"mygrpc/internal/grpctest"
+	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/interceptor/recovery"
+	"mygrpc/pkg/metrics"
+	"mygrpc/pkg/tracing"
+)
+
+// panickingServer はわざとpanicするテスト用のサービス
+type panickingServer struct {
+	hellopb.UnimplementedGreetingServiceServer
+}
+
+func (s *panickingServer) Hello(_ context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
+	if req.GetName() == "panic" {
+		panic("boom")
+	}
+	return &hellopb.HelloResponse{Message: "Hello, " + req.GetName() + "!"}, nil
+}
+
+func (s *panickingServer) HelloServerStream(req *hellopb.HelloRequest, stream hellopb.GreetingService_HelloServerStreamServer) error {
+	if err := stream.Send(&hellopb.HelloResponse{Message: "first"}); err != nil {
+		return err
+	}
+	var m map[string]int
+	m["nil map"]++ // 2件目を送る前にpanicする
+	return nil
+}
+
+func newClient(t *testing.T, opts ...recovery.Option) hellopb.GreetingServiceClient {
+	t.Helper()
+
+	tracer := tracing.NewTracer(nil)
+	client, _ := grpctest.NewGreeting(t, &panickingServer{},
+		grpc.ChainUnaryInterceptor(tracer.UnaryServerInterceptor(), recovery.UnaryServerInterceptor(opts...)),
+		grpc.ChainStreamInterceptor(tracer.StreamServerInterceptor(), recovery.StreamServerInterceptor(opts...)),
+	)
+	return client
+}
+
+func TestUnary(t *testing.T) {
+	var buf bytes.Buffer
+	// リクエストIDはトレースのコンテキストからログのハンドラが付ける
+	logger := slog.New(tracing.NewLogHandler(slog.NewJSONHandler(&buf, nil)))
+	panics := metrics.NewRegistry().NewCounterVec("grpc_server_panics_total", "panics", "grpc_method")
+	client := newClient(t, recovery.WithLogger(logger), recovery.WithPanicCounter(panics))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), tracing.RequestIDKey, "req-1")
+	_, err := client.Hello(ctx, &hellopb.HelloRequest{Name: "panic"})
+	stat := status.Convert(err)
+	if stat.Code() != codes.Internal {
+		t.Fatalf("code = %s, want Internal", stat.Code())
+	}
+	if len(stat.Details()) != 0 {
+		t.Errorf("details = %v, want none without debug", stat.Details())
+	}
+
+	// panicの後もサーバーは動き続ける
+	if _, err := client.Hello(ctx, &hellopb.HelloRequest{Name: "gopher"}); err != nil {
+		t.Fatalf("call after panic: %v", err)
+	}
+
+	if got := panics.With("/myapp.GreetingService/Hello").Value(); got != 1 {
+		t.Errorf("panic count = %v, want 1", got)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log = %q: %v", buf.String(), err)
+	}
+	if record["grpc.method"] != "/myapp.GreetingService/Hello" {
+		t.Errorf("grpc.method = %v", record["grpc.method"])
+	}
+	if record["request_id"] != "req-1" || strings.Count(buf.String(), `"request_id"`) != 1 {
+		t.Errorf("log = %s, want one request_id req-1", buf.String())
+	}
+	if record["panic"] != "boom" {
+		t.Errorf("panic = %v, want boom", record["panic"])
+	}
+	if stack, _ := record["stack"].(string); !strings.Contains(stack, "panickingServer).Hello") {
+		t.Errorf("stack does not include the handler: %q", stack)
+	}
+}
+
+func TestStreamDebug(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	client := newClient(t, recovery.WithLogger(logger), recovery.WithDebug(true))
+
+	stream, err := client.HelloServerStream(context.Background(), &hellopb.HelloRequest{Name: "gopher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("first message: %v", err)
+	}
+	_, err = stream.Recv()
+	stat := status.Convert(err)
+	if stat.Code() != codes.Internal {
+		t.Fatalf("code = %s, want Internal", stat.Code())
+	}
+
+	var info *errdetails.DebugInfo
+	for _, d := range stat.Details() {
+		if di, ok := d.(*errdetails.DebugInfo); ok {
+			info = di
+		}
+	}
+	if info == nil {
+		t.Fatalf("details = %v, want DebugInfo", stat.Details())
+	}
+	if !strings.Contains(info.GetDetail(), "nil map") {
+		t.Errorf("detail = %q, want the panic value", info.GetDetail())
+	}
+	if len(info.GetStackEntries()) == 0 {
+		t.Error("stack entries are empty")
+	}
+}
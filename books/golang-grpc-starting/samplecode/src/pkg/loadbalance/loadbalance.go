@@ -0,0 +1,40 @@
+// Package loadbalance spreads client RPCs over several server addresses.
+//
+// It registers a "static" resolver for comma separated address lists, which
+// may carry a weight per address like "host1:8080=3,host2:8080=1", and a
+// "weighted" balancer that picks addresses in proportion to those weights.
+// Both balancers here and grpc-go's round_robin only pick backends whose
+// health service reports SERVING when the service config has a
+// healthCheckConfig.
+package loadbalance
+
+import (
+	"strings"
+
+	// クライアント側のヘルスチェックを有効にする
+	_ "google.golang.org/grpc/health"
+)
+
+// Scheme is the scheme of the static resolver.
+const Scheme = "static"
+
+// Policies that can be used in the loadBalancingConfig of a service config.
+const (
+	RoundRobin = "round_robin"
+	Weighted   = "weighted"
+)
+
+// Target returns the dial target for addr.
+//
+// A target with a scheme such as "dns:///myapp:8080" is returned as is. A
+// comma separated list or an address with a weight is turned into a target of
+// the static resolver. Anything else is a single address dialed directly.
+func Target(addr string) string {
+	if strings.Contains(addr, "://") {
+		return addr
+	}
+	if strings.ContainsAny(addr, ",=") {
+		return Scheme + ":///" + addr
+	}
+	return addr
+}
@@ -0,0 +1,187 @@
+package loadbalance_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/loadbalance"
+)
+
+const healthService = "mygrpc"
+
+// backend はTCPで待ち受けるテスト用のサーバー
+type backend struct {
+	hellopb.UnimplementedGreetingServiceServer
+
+	addr   string
+	s      *grpc.Server
+	health *health.Server
+	calls  atomic.Int64
+}
+
+func (b *backend) Hello(_ context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
+	b.calls.Add(1)
+	return &hellopb.HelloResponse{Message: "Hello, " + req.GetName() + "!"}, nil
+}
+
+func startBackends(t *testing.T, n int) []*backend {
+	t.Helper()
+	backends := make([]*backend, n)
+	for i := range backends {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := &backend{addr: lis.Addr().String(), s: grpc.NewServer(), health: health.NewServer()}
+		hellopb.RegisterGreetingServiceServer(b.s, b)
+		healthpb.RegisterHealthServer(b.s, b.health)
+		b.health.SetServingStatus(healthService, healthpb.HealthCheckResponse_SERVING)
+		go b.s.Serve(lis)
+		t.Cleanup(b.s.Stop)
+		backends[i] = b
+	}
+	return backends
+}
+
+func dial(t *testing.T, target, policy string) hellopb.GreetingServiceClient {
+	t.Helper()
+	sc := fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}], "healthCheckConfig": {"serviceName": %q}}`, policy, healthService)
+	conn, err := grpc.Dial(loadbalance.Target(target),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(sc),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return hellopb.NewGreetingServiceClient(conn)
+}
+
+// distribution はn回呼び出して、各バックエンドが受けた回数を返す
+// 呼び出しが1つでも失敗したらnilを返す
+func distribution(client hellopb.GreetingServiceClient, backends []*backend, n int) []int64 {
+	for _, b := range backends {
+		b.calls.Store(0)
+	}
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := client.Hello(ctx, &hellopb.HelloRequest{Name: "gopher"}, grpc.WaitForReady(true))
+		cancel()
+		if err != nil {
+			return nil
+		}
+	}
+	got := make([]int64, len(backends))
+	for i, b := range backends {
+		got[i] = b.calls.Load()
+	}
+	return got
+}
+
+// waitDistribution は呼び出しの配分がwantになるまで繰り返す
+// 接続やヘルスチェックの状態の反映を待つため
+func waitDistribution(t *testing.T, client hellopb.GreetingServiceClient, backends []*backend, want []int64) {
+	t.Helper()
+	var n int64
+	for _, w := range want {
+		n += w
+	}
+	var got []int64
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got = distribution(client, backends, int(n))
+		if fmt.Sprint(got) == fmt.Sprint(want) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("distribution = %v, want %v", got, want)
+}
+
+func TestRoundRobin(t *testing.T) {
+	backends := startBackends(t, 3)
+	addrs := make([]string, len(backends))
+	for i, b := range backends {
+		addrs[i] = b.addr
+	}
+	client := dial(t, strings.Join(addrs, ","), loadbalance.RoundRobin)
+
+	waitDistribution(t, client, backends, []int64{10, 10, 10})
+
+	// 止めたサーバーには振り分けられなくなる
+	backends[1].s.Stop()
+	waitDistribution(t, client, backends, []int64{10, 0, 10})
+
+	// NOT_SERVINGのサーバーは接続できても選ばれず、SERVINGに戻れば再び選ばれる
+	backends[0].health.SetServingStatus(healthService, healthpb.HealthCheckResponse_NOT_SERVING)
+	waitDistribution(t, client, backends, []int64{0, 0, 20})
+	backends[0].health.SetServingStatus(healthService, healthpb.HealthCheckResponse_SERVING)
+	waitDistribution(t, client, backends, []int64{10, 0, 10})
+}
+
+func TestWeighted(t *testing.T) {
+	backends := startBackends(t, 3)
+	target := fmt.Sprintf("%s=3,%s=1,%s", backends[0].addr, backends[1].addr, backends[2].addr)
+	client := dial(t, target, loadbalance.Weighted)
+
+	// 重みのないアドレスは1として扱う
+	waitDistribution(t, client, backends, []int64{30, 10, 10})
+
+	backends[0].health.SetServingStatus(healthService, healthpb.HealthCheckResponse_NOT_SERVING)
+	waitDistribution(t, client, backends, []int64{0, 10, 10})
+}
+
+func TestParseAddresses(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "a:1,b:2=3", want: []string{"a:1", "b:2"}},
+		{in: " a:1 , ", want: []string{"a:1"}},
+		{in: "a:1=0", wantErr: true},
+		{in: "a:1=x", wantErr: true},
+		{in: "a", wantErr: true},
+		{in: ",", wantErr: true},
+	}
+	for _, tt := range tests {
+		addrs, err := loadbalance.ParseAddresses(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAddresses(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, a := range addrs {
+			got = append(got, a.Addr)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ParseAddresses(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTarget(t *testing.T) {
+	tests := map[string]string{
+		"localhost:8080":        "localhost:8080",
+		"dns:///myapp:8080":     "dns:///myapp:8080",
+		"a:1,b:2":               "static:///a:1,b:2",
+		"localhost:8080=2":      "static:///localhost:8080=2",
+		"unix:///tmp/grpc.sock": "unix:///tmp/grpc.sock",
+	}
+	for in, want := range tests {
+		if got := loadbalance.Target(in); got != want {
+			t.Errorf("Target(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
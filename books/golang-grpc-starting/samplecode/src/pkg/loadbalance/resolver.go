@@ -0,0 +1,71 @@
+package loadbalance
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/balancer/weightedroundrobin"
+	"google.golang.org/grpc/resolver"
+)
+
+func init() {
+	resolver.Register(staticBuilder{})
+}
+
+// staticBuilder は固定のアドレス一覧を返すリゾルバを作る
+type staticBuilder struct{}
+
+func (staticBuilder) Scheme() string { return Scheme }
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	endpoint := strings.TrimPrefix(target.URL.Path, "/")
+	if endpoint == "" {
+		endpoint = target.URL.Opaque
+	}
+	addrs, err := ParseAddresses(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		return nil, fmt.Errorf("loadbalance: %w", err)
+	}
+	return staticResolver{}, nil
+}
+
+// staticResolver はアドレスが変わらないので何もしない
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+func (staticResolver) Close()                                {}
+
+// ParseAddresses parses a comma separated list of "host:port" or
+// "host:port=weight". The weight defaults to 1.
+func ParseAddresses(s string) ([]resolver.Address, error) {
+	var addrs []resolver.Address
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		hostport, w, hasWeight := strings.Cut(item, "=")
+		if _, _, err := net.SplitHostPort(hostport); err != nil {
+			return nil, fmt.Errorf("loadbalance: address %q: %w", hostport, err)
+		}
+		weight := uint32(1)
+		if hasWeight {
+			n, err := strconv.ParseUint(w, 10, 32)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("loadbalance: weight of %s must be a positive integer, got %q", hostport, w)
+			}
+			weight = uint32(n)
+		}
+		addr := resolver.Address{Addr: hostport}
+		addrs = append(addrs, weightedroundrobin.SetAddrInfo(addr, weightedroundrobin.AddrInfo{Weight: weight}))
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("loadbalance: no address in %q", s)
+	}
+	return addrs, nil
+}
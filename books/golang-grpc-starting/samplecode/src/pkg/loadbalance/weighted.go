@@ -0,0 +1,63 @@
+package loadbalance
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/weightedroundrobin"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(Weighted, weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+type weightedPickerBuilder struct{}
+
+// Build は接続可能(ヘルスチェックが有効ならSERVING)なサブコネクションだけで
+// ピッカーを作る。状態が変わるたびに作り直される
+func (weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &weightedPicker{}
+	for sc, sci := range info.ReadySCs {
+		w := int(weightedroundrobin.GetAddrInfo(sci.Address).Weight)
+		if w <= 0 {
+			// dns:///などの重みのないアドレスは均等に扱う
+			w = 1
+		}
+		p.backends = append(p.backends, &weightedBackend{sc: sc, weight: w})
+		p.total += w
+	}
+	return p
+}
+
+type weightedBackend struct {
+	sc      balancer.SubConn
+	weight  int
+	current int
+}
+
+// weightedPicker は重み付きラウンドロビン(nginxのsmooth weighted round-robin)で選ぶ
+// 重みが3:1なら a a b a のように、同じバックエンドに偏らずに混ざる
+type weightedPicker struct {
+	mu       sync.Mutex
+	backends []*weightedBackend
+	total    int
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *weightedBackend
+	for _, b := range p.backends {
+		b.current += b.weight
+		if best == nil || b.current > best.current {
+			best = b
+		}
+	}
+	best.current -= p.total
+	return balancer.PickResult{SubConn: best.sc}, nil
+}
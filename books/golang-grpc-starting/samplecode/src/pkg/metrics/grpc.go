@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// ServerMetrics instruments a gRPC server. Install its interceptors with
+// grpc.ChainUnaryInterceptor / grpc.ChainStreamInterceptor and itself with
+// grpc.StatsHandler; the stats handler counts the messages of every stream.
+type ServerMetrics struct {
+	handled  *CounterVec
+	latency  *HistogramVec
+	inFlight *GaugeVec
+	msgRecv  *CounterVec
+	msgSent  *CounterVec
+}
+
+var _ stats.Handler = (*ServerMetrics)(nil)
+
+// NewServerMetrics registers the gRPC server metrics in r.
+func NewServerMetrics(r *Registry) *ServerMetrics {
+	return &ServerMetrics{
+		handled: r.NewCounterVec("grpc_server_handled_total",
+			"Total number of RPCs completed on the server, regardless of success or failure.",
+			"grpc_type", "grpc_method", "grpc_code"),
+		latency: r.NewHistogramVec("grpc_server_handling_seconds",
+			"Histogram of response latency (seconds) of RPCs handled by the server.",
+			DefaultBuckets, "grpc_type", "grpc_method"),
+		inFlight: r.NewGaugeVec("grpc_server_streams_in_flight",
+			"Number of streaming RPCs currently being handled by the server.",
+			"grpc_type", "grpc_method"),
+		msgRecv: r.NewCounterVec("grpc_server_msg_received_total",
+			"Total number of stream messages received from the client.",
+			"grpc_type", "grpc_method"),
+		msgSent: r.NewCounterVec("grpc_server_msg_sent_total",
+			"Total number of stream messages sent by the server.",
+			"grpc_type", "grpc_method"),
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor that counts unary RPCs and
+// observes their latency.
+func (m *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+		m.observe("unary", info.FullMethod, start, err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that counts streaming RPCs,
+// observes their latency and tracks how many are in flight.
+func (m *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		typ := streamType(info.IsClientStream, info.IsServerStream)
+		gauge := m.inFlight.With(typ, info.FullMethod)
+		gauge.Add(1)
+		defer gauge.Add(-1)
+
+		start := time.Now()
+		err := handler(srv, ss)
+		m.observe(typ, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func (m *ServerMetrics) observe(typ, method string, start time.Time, err error) {
+	m.handled.With(typ, method, status.Code(err).String()).Inc()
+	m.latency.With(typ, method).Observe(time.Since(start).Seconds())
+}
+
+func streamType(client, server bool) string {
+	switch {
+	case client && server:
+		return "bidi_stream"
+	case client:
+		return "client_stream"
+	case server:
+		return "server_stream"
+	default:
+		return "unary"
+	}
+}
+
+type rpcInfoKey struct{}
+
+type rpcInfo struct {
+	method string
+	typ    string
+}
+
+// TagRPC implements stats.Handler.
+func (m *ServerMetrics) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, rpcInfoKey{}, &rpcInfo{method: info.FullMethodName})
+}
+
+// HandleRPC implements stats.Handler. It counts the messages of streaming RPCs.
+func (m *ServerMetrics) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	info, ok := ctx.Value(rpcInfoKey{}).(*rpcInfo)
+	if !ok || s.IsClient() {
+		return
+	}
+
+	switch s := s.(type) {
+	case *stats.Begin:
+		// ストリームの種類はBeginでしか分からないので覚えておく
+		info.typ = streamType(s.IsClientStream, s.IsServerStream)
+	case *stats.InPayload:
+		if info.typ != "unary" {
+			m.msgRecv.With(info.typ, info.method).Inc()
+		}
+	case *stats.OutPayload:
+		if info.typ != "unary" {
+			m.msgSent.With(info.typ, info.method).Inc()
+		}
+	}
+}
+
+// TagConn implements stats.Handler.
+func (m *ServerMetrics) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (m *ServerMetrics) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,108 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"mygrpc/internal/grpctest"
+	"mygrpc/pkg/metrics"
+)
+
+func TestServerMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := metrics.NewServerMetrics(reg)
+
+	s := grpctest.NewServer(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, health.NewServer())
+	},
+		grpc.ChainUnaryInterceptor(m.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(m.StreamServerInterceptor()),
+		grpc.StatsHandler(m),
+	)
+	client := healthpb.NewHealthClient(s.Dial(t))
+
+	ctx := context.Background()
+	client.Check(ctx, &healthpb.HealthCheckRequest{})
+	client.Check(ctx, &healthpb.HealthCheckRequest{})
+	client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(watchCtx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	httpSrv := httptest.NewServer(reg)
+	t.Cleanup(httpSrv.Close)
+	res, err := http.Get(httpSrv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+
+	want := []string{
+		"# TYPE grpc_server_handled_total counter",
+		`grpc_server_handled_total{grpc_type="unary",grpc_method="/grpc.health.v1.Health/Check",grpc_code="OK"} 2`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_method="/grpc.health.v1.Health/Check",grpc_code="NotFound"} 1`,
+		"# TYPE grpc_server_handling_seconds histogram",
+		`grpc_server_handling_seconds_bucket{grpc_type="unary",grpc_method="/grpc.health.v1.Health/Check",le="+Inf"} 3`,
+		`grpc_server_handling_seconds_count{grpc_type="unary",grpc_method="/grpc.health.v1.Health/Check"} 3`,
+		`grpc_server_streams_in_flight{grpc_type="server_stream",grpc_method="/grpc.health.v1.Health/Watch"} 1`,
+		`grpc_server_msg_received_total{grpc_type="server_stream",grpc_method="/grpc.health.v1.Health/Watch"} 1`,
+		`grpc_server_msg_sent_total{grpc_type="server_stream",grpc_method="/grpc.health.v1.Health/Watch"} 1`,
+	}
+	for _, w := range want {
+		if !strings.Contains(body, w+"\n") {
+			t.Errorf("metrics do not contain %q\n%s", w, body)
+		}
+	}
+}
+
+func TestRegistryText(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.NewCounterVec("test_total", "Help with \\ and\nnewline.", "label")
+	c.With(`a"b`).Add(1.5)
+	h := reg.NewHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1})
+	h.With().Observe(0.05)
+	h.With().Observe(0.5)
+	h.With().Observe(5)
+
+	var sb strings.Builder
+	if err := reg.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_total Help with \\ and\nnewline.
+# TYPE test_total counter
+test_total{label="a\"b"} 1.5
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 5.55
+test_seconds_count 3
+`
+	if sb.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
@@ -0,0 +1,154 @@
+// Package metrics is a minimal metrics registry that is exposed in the
+// Prometheus text format, and gRPC server instrumentation built on it.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metrics and writes them in the Prometheus text format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]struct{}
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.names[name]; ok {
+		panic(fmt.Sprintf("metrics: %s is already registered", name))
+	}
+	r.names[name] = struct{}{}
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText writes all metrics to w in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics, so a Registry can be mounted on "/metrics".
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// vec は同じ名前でラベル値の異なる系列をまとめて持つ
+type vec[T any] struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	newFn  func() T
+
+	mu     sync.Mutex
+	series map[string]*labeled[T]
+}
+
+type labeled[T any] struct {
+	values []string
+	value  T
+}
+
+func newVec[T any](name, help, typ string, labels []string, newFn func() T) *vec[T] {
+	return &vec[T]{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		newFn:  newFn,
+		series: make(map[string]*labeled[T]),
+	}
+}
+
+func (v *vec[T]) with(values []string) T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &labeled[T]{values: append([]string(nil), values...), value: v.newFn()}
+		v.series[key] = s
+	}
+	return s.value
+}
+
+// sorted はラベル値の順に並べた系列を返す
+func (v *vec[T]) sorted() []*labeled[T] {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	series := make([]*labeled[T], 0, len(v.series))
+	for _, s := range v.series {
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].values, "\xff") < strings.Join(series[j].values, "\xff")
+	})
+	return series
+}
+
+func (v *vec[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, helpEscaper.Replace(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+func (v *vec[T]) labelPairs(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, l := range v.labels {
+		pairs = append(pairs, l+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
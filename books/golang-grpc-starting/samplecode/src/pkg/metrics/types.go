@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	v *vec[*Counter]
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	mu  sync.Mutex
+	val float64
+}
+
+// NewCounterVec registers a counter named name with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{v: newVec(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+	r.register(name, c)
+	return c
+}
+
+// With returns the counter for the label values, creating it if needed.
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.v.with(values)
+}
+
+// Inc adds 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds d, which must not be negative.
+func (c *Counter) Add(d float64) {
+	if d < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.val += d
+}
+
+// Value returns the current value.
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.val
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.v.writeHeader(w)
+	for _, s := range c.v.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.v.name, c.v.labelPairs(s.values), formatFloat(s.value.Value()))
+	}
+}
+
+// GaugeVec is a set of gauges partitioned by label values.
+type GaugeVec struct {
+	v *vec[*Gauge]
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	mu  sync.Mutex
+	val float64
+}
+
+// NewGaugeVec registers a gauge named name with the given label names.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{v: newVec(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+	r.register(name, g)
+	return g
+}
+
+// With returns the gauge for the label values, creating it if needed.
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.v.with(values)
+}
+
+// Add adds d, which may be negative.
+func (g *Gauge) Add(d float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.val += d
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.val
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.v.writeHeader(w)
+	for _, s := range g.v.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", g.v.name, g.v.labelPairs(s.values), formatFloat(s.value.Value()))
+	}
+}
+
+// DefaultBuckets are histogram buckets in seconds suited to RPC latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	v *vec[*Histogram]
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	upperBounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // 各バケットに入った数(累積ではない)。最後は+Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a histogram named name with the given upper
+// bounds (in increasing order) and label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	bounds := append(append([]float64(nil), buckets...), math.Inf(1))
+	h := &HistogramVec{v: newVec(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{upperBounds: bounds, counts: make([]uint64, len(bounds))}
+	})}
+	r.register(name, h)
+	return h
+}
+
+// With returns the histogram for the label values, creating it if needed.
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.v.with(values)
+}
+
+// Observe adds one observation.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, ub := range h.upperBounds {
+		if v <= ub {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.v.writeHeader(w)
+	for _, s := range h.v.sorted() {
+		hist := s.value
+		hist.mu.Lock()
+		var cumulative uint64
+		for i, ub := range hist.upperBounds {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.v.name, h.v.labelPairs(s.values, "le", formatFloat(ub)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.v.name, h.v.labelPairs(s.values), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.v.name, h.v.labelPairs(s.values), hist.count)
+		hist.mu.Unlock()
+	}
+}
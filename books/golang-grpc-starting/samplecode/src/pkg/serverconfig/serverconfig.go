@@ -0,0 +1,268 @@
+// Package serverconfig holds the transport settings of the gRPC server:
+// the listen port, keepalive enforcement, connection age and the limits on
+// messages and streams.
+//
+// The settings are read from a YAML file, then MYGRPC_* environment variables,
+// then command line flags, each overriding the previous one.
+package serverconfig
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables. The rest of the name
+// is the flag name in upper case with "-" replaced by "_", such as MYGRPC_PORT.
+const EnvPrefix = "MYGRPC_"
+
+// HealthService is the service on the health service that reports whether
+// the server is ready to take requests. The overall "" service reports
+// whether the process is alive.
+const HealthService = "mygrpc"
+
+// Config is the transport configuration of the server.
+type Config struct {
+	// Port is the port gRPC and HTTP are served on.
+	Port int `yaml:"port"`
+
+	Keepalive Keepalive `yaml:"keepalive"`
+
+	// MaxRecvMsgSize and MaxSendMsgSize are the largest messages in bytes
+	// the server receives and sends.
+	MaxRecvMsgSize int `yaml:"max_recv_msg_size"`
+	MaxSendMsgSize int `yaml:"max_send_msg_size"`
+	// MaxConcurrentStreams is the number of concurrent streams per connection.
+	MaxConcurrentStreams int `yaml:"max_concurrent_streams"`
+}
+
+// Keepalive configures how the server treats long-lived connections.
+type Keepalive struct {
+	// MinTime is the shortest interval at which clients may send pings.
+	// Connections of clients that ping more often are closed.
+	MinTime time.Duration `yaml:"min_time"`
+	// PermitWithoutStream allows pings while the client has no active stream.
+	PermitWithoutStream bool `yaml:"permit_without_stream"`
+	// MaxConnectionAge is how long a connection may live before the server
+	// sends GOAWAY, so that clients reconnect and spread over new backends.
+	// Zero means no limit.
+	MaxConnectionAge time.Duration `yaml:"max_connection_age"`
+	// MaxConnectionAgeGrace is how long the RPCs in flight may take after
+	// MaxConnectionAge before the connection is closed. Zero means no limit.
+	MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace"`
+}
+
+// Default returns the configuration used when nothing is specified.
+func Default() Config {
+	return Config{
+		Port: 8080,
+		Keepalive: Keepalive{
+			MinTime: 5 * time.Minute,
+		},
+		MaxRecvMsgSize:       4 << 20,
+		MaxSendMsgSize:       4 << 20,
+		MaxConcurrentStreams: 100,
+	}
+}
+
+// Validate reports every invalid setting.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %d", c.Port))
+	}
+	if c.Keepalive.MinTime < 0 {
+		errs = append(errs, fmt.Errorf("keepalive.min_time must not be negative, got %s", c.Keepalive.MinTime))
+	}
+	if c.Keepalive.MaxConnectionAge < 0 {
+		errs = append(errs, fmt.Errorf("keepalive.max_connection_age must not be negative, got %s", c.Keepalive.MaxConnectionAge))
+	}
+	if c.Keepalive.MaxConnectionAgeGrace < 0 {
+		errs = append(errs, fmt.Errorf("keepalive.max_connection_age_grace must not be negative, got %s", c.Keepalive.MaxConnectionAgeGrace))
+	}
+	if c.Keepalive.MaxConnectionAgeGrace > 0 && c.Keepalive.MaxConnectionAge == 0 {
+		errs = append(errs, errors.New("keepalive.max_connection_age_grace requires keepalive.max_connection_age"))
+	}
+	if c.MaxRecvMsgSize <= 0 || c.MaxRecvMsgSize > math.MaxInt32 {
+		errs = append(errs, fmt.Errorf("max_recv_msg_size must be between 1 and %d, got %d", math.MaxInt32, c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize <= 0 || c.MaxSendMsgSize > math.MaxInt32 {
+		errs = append(errs, fmt.Errorf("max_send_msg_size must be between 1 and %d, got %d", math.MaxInt32, c.MaxSendMsgSize))
+	}
+	if c.MaxConcurrentStreams <= 0 || int64(c.MaxConcurrentStreams) > math.MaxUint32 {
+		errs = append(errs, fmt.Errorf("max_concurrent_streams must be between 1 and %d, got %d", uint32(math.MaxUint32), c.MaxConcurrentStreams))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("serverconfig: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// ServerOptions returns the options that apply c to a grpc.Server.
+func (c Config) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.Keepalive.MinTime,
+			PermitWithoutStream: c.Keepalive.PermitWithoutStream,
+		}),
+		// grpc-goではゼロは無制限を意味する
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionAge:      c.Keepalive.MaxConnectionAge,
+			MaxConnectionAgeGrace: c.Keepalive.MaxConnectionAgeGrace,
+		}),
+		grpc.MaxRecvMsgSize(c.MaxRecvMsgSize),
+		grpc.MaxSendMsgSize(c.MaxSendMsgSize),
+		grpc.MaxConcurrentStreams(uint32(c.MaxConcurrentStreams)),
+	}
+}
+
+// LogValue logs c as a group of its settings.
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("port", c.Port),
+		slog.Group("keepalive",
+			slog.Duration("min_time", c.Keepalive.MinTime),
+			slog.Bool("permit_without_stream", c.Keepalive.PermitWithoutStream),
+			slog.Duration("max_connection_age", c.Keepalive.MaxConnectionAge),
+			slog.Duration("max_connection_age_grace", c.Keepalive.MaxConnectionAgeGrace),
+		),
+		slog.Int("max_recv_msg_size", c.MaxRecvMsgSize),
+		slog.Int("max_send_msg_size", c.MaxSendMsgSize),
+		slog.Int("max_concurrent_streams", c.MaxConcurrentStreams),
+	)
+}
+
+// Parse decodes a YAML document over the defaults. Unknown keys are errors.
+func Parse(b []byte) (Config, error) {
+	c := Default()
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("serverconfig: %w", err)
+	}
+	return c, nil
+}
+
+// LoadFile reads a YAML file over the defaults.
+func LoadFile(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(b)
+}
+
+// Loader reads the configuration from a file, the environment and flags.
+type Loader struct {
+	fs    *flag.FlagSet
+	conf  Config
+	path  string
+	names []string
+}
+
+// RegisterFlags registers -config and a flag for every setting on fs.
+// Call Load after fs has been parsed.
+func RegisterFlags(fs *flag.FlagSet) *Loader {
+	l := &Loader{fs: fs, conf: Default()}
+	fs.StringVar(&l.path, "config", "", "YAML file of the server config (env "+EnvPrefix+"CONFIG)")
+
+	c := &l.conf
+	l.intVar(&c.Port, "port", "port gRPC and HTTP are served on")
+	l.durationVar(&c.Keepalive.MinTime, "keepalive-min-time", "shortest interval at which clients may send keepalive pings")
+	l.boolVar(&c.Keepalive.PermitWithoutStream, "keepalive-permit-without-stream", "allow keepalive pings while the client has no active stream")
+	l.durationVar(&c.Keepalive.MaxConnectionAge, "max-connection-age", "how long a connection may live before the server sends GOAWAY (0 for no limit)")
+	l.durationVar(&c.Keepalive.MaxConnectionAgeGrace, "max-connection-age-grace", "how long RPCs may take after max-connection-age (0 for no limit)")
+	l.intVar(&c.MaxRecvMsgSize, "max-recv-msg-size", "largest message in bytes the server receives")
+	l.intVar(&c.MaxSendMsgSize, "max-send-msg-size", "largest message in bytes the server sends")
+	l.intVar(&c.MaxConcurrentStreams, "max-concurrent-streams", "number of concurrent streams per connection")
+	return l
+}
+
+func (l *Loader) intVar(p *int, name, usage string) {
+	l.fs.IntVar(p, name, *p, usage+" (env "+envName(name)+")")
+	l.names = append(l.names, name)
+}
+
+func (l *Loader) durationVar(p *time.Duration, name, usage string) {
+	l.fs.DurationVar(p, name, *p, usage+" (env "+envName(name)+")")
+	l.names = append(l.names, name)
+}
+
+func (l *Loader) boolVar(p *bool, name, usage string) {
+	l.fs.BoolVar(p, name, *p, usage+" (env "+envName(name)+")")
+	l.names = append(l.names, name)
+}
+
+// Environ returns c as the environment variables Load reads, in the form
+// "NAME=value".
+func (c Config) Environ() []string {
+	l := RegisterFlags(flag.NewFlagSet("", flag.ContinueOnError))
+	l.conf = c
+	env := make([]string, 0, len(l.names))
+	for _, name := range l.names {
+		env = append(env, envName(name)+"="+l.fs.Lookup(name).Value.String())
+	}
+	return env
+}
+
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Load merges the file, the environment looked up by lookupEnv and the flags
+// set on the command line, and validates the result.
+func (l *Loader) Load(lookupEnv func(string) (string, bool)) (Config, error) {
+	// フラグの値はconfに直接書き込まれているので、明示的に指定されたものだけを覚えておき、
+	// ファイルと環境変数を反映した後に設定し直す
+	set := make(map[string]string)
+	l.fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+
+	path := l.path
+	if _, ok := set["config"]; !ok {
+		if v, ok := lookupEnv(EnvPrefix + "CONFIG"); ok {
+			path = v
+		}
+	}
+	l.conf = Default()
+	if path != "" {
+		c, err := LoadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		l.conf = c
+	}
+
+	for _, name := range l.names {
+		env := envName(name)
+		if v, ok := lookupEnv(env); ok {
+			if err := l.fs.Set(name, v); err != nil {
+				return Config{}, fmt.Errorf("serverconfig: %s: %w", env, err)
+			}
+		}
+	}
+	for _, name := range l.names {
+		if v, ok := set[name]; ok {
+			if err := l.fs.Set(name, v); err != nil {
+				return Config{}, err
+			}
+		}
+	}
+
+	if err := l.conf.Validate(); err != nil {
+		return Config{}, err
+	}
+	return l.conf, nil
+}
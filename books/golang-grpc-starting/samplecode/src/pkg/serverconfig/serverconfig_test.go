@@ -0,0 +1,163 @@
+package serverconfig_test
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mygrpc/pkg/serverconfig"
+)
+
+const configYAML = `
+port: 9090
+keepalive:
+  min_time: 10s
+  permit_without_stream: true
+  max_connection_age: 30m
+  max_connection_age_grace: 1m
+max_recv_msg_size: 1048576
+`
+
+func TestParse(t *testing.T) {
+	c, err := serverconfig.Parse([]byte(configYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := serverconfig.Default()
+	want.Port = 9090
+	want.Keepalive = serverconfig.Keepalive{
+		MinTime:               10 * time.Second,
+		PermitWithoutStream:   true,
+		MaxConnectionAge:      30 * time.Minute,
+		MaxConnectionAgeGrace: time.Minute,
+	}
+	want.MaxRecvMsgSize = 1 << 20
+	if c != want {
+		t.Errorf("Parse() = %+v, want %+v", c, want)
+	}
+
+	// 空のファイルはデフォルト値のまま
+	if c, err := serverconfig.Parse(nil); err != nil || c != serverconfig.Default() {
+		t.Errorf("Parse(nil) = %+v, %v", c, err)
+	}
+
+	// 綴りの誤りで設定が黙って無視されないようにする
+	if _, err := serverconfig.Parse([]byte("max_conection_age: 1m\n")); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte(configYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		check   func(serverconfig.Config) bool
+		wantErr string
+	}{
+		{
+			name:  "defaults",
+			check: func(c serverconfig.Config) bool { return c == serverconfig.Default() },
+		},
+		{
+			name:  "file",
+			args:  []string{"-config", path},
+			check: func(c serverconfig.Config) bool { return c.Port == 9090 && c.MaxRecvMsgSize == 1<<20 },
+		},
+		{
+			name:  "file from env",
+			env:   map[string]string{"MYGRPC_CONFIG": path},
+			check: func(c serverconfig.Config) bool { return c.Port == 9090 },
+		},
+		{
+			name: "env overrides file",
+			args: []string{"-config", path},
+			env:  map[string]string{"MYGRPC_PORT": "7070", "MYGRPC_MAX_CONNECTION_AGE": "1h"},
+			check: func(c serverconfig.Config) bool {
+				return c.Port == 7070 && c.Keepalive.MaxConnectionAge == time.Hour && c.Keepalive.MinTime == 10*time.Second
+			},
+		},
+		{
+			name: "flag overrides env",
+			args: []string{"-config", path, "-port", "6060"},
+			env:  map[string]string{"MYGRPC_PORT": "7070"},
+			check: func(c serverconfig.Config) bool {
+				return c.Port == 6060 && c.Keepalive.PermitWithoutStream
+			},
+		},
+		{
+			name:    "invalid env",
+			env:     map[string]string{"MYGRPC_MAX_CONCURRENT_STREAMS": "many"},
+			wantErr: "MYGRPC_MAX_CONCURRENT_STREAMS",
+		},
+		{
+			name:    "validation",
+			args:    []string{"-port", "0", "-max-connection-age-grace", "5s"},
+			wantErr: "max_connection_age_grace requires",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("server", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			l := serverconfig.RegisterFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			c, err := l.Load(func(k string) (string, bool) {
+				v, ok := tt.env[k]
+				return v, ok
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(c) {
+				t.Errorf("Load() = %+v", c)
+			}
+		})
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	want, err := serverconfig.Parse([]byte(configYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	for _, kv := range want.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	// 書き出した環境変数を読み込むと元の設定に戻る
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	l := serverconfig.RegisterFlags(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := l.Load(func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Load(Environ()) = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+// Package tlstest generates a throwaway certificate authority and
+// certificates signed by it, so TLS can be tested offline.
+package tlstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// CA is an in-process certificate authority.
+type CA struct {
+	// CertFile is the path of the PEM encoded CA certificate.
+	CertFile string
+
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+// KeyPair is the paths of a PEM encoded certificate and its private key.
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// NewCA creates a CA whose files are removed when the test finishes.
+func NewCA(t testing.TB) *CA {
+	t.Helper()
+
+	key := newKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          newSerial(t),
+		Subject:               pkix.Name{CommonName: "tlstest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &CA{cert: cert, key: key, dir: t.TempDir()}
+	ca.CertFile = ca.writePEM(t, "ca-*.crt", "CERTIFICATE", der)
+	return ca
+}
+
+// IssueServer issues a server certificate valid for the given DNS names and IP addresses.
+func (ca *CA) IssueServer(t testing.TB, hosts ...string) KeyPair {
+	t.Helper()
+
+	tmpl := ca.template(t, "tlstest server", x509.ExtKeyUsageServerAuth)
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	return ca.issue(t, tmpl)
+}
+
+// IssueClient issues a client certificate with the given common name.
+func (ca *CA) IssueClient(t testing.TB, commonName string) KeyPair {
+	t.Helper()
+	return ca.issue(t, ca.template(t, commonName, x509.ExtKeyUsageClientAuth))
+}
+
+func (ca *CA) template(t testing.TB, commonName string, usage x509.ExtKeyUsage) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: newSerial(t),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+}
+
+func (ca *CA) issue(t testing.TB, tmpl *x509.Certificate) KeyPair {
+	t.Helper()
+
+	key := newKey(t)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return KeyPair{
+		CertFile: ca.writePEM(t, "*.crt", "CERTIFICATE", der),
+		KeyFile:  ca.writePEM(t, "*.key", "EC PRIVATE KEY", keyDER),
+	}
+}
+
+func (ca *CA) writePEM(t testing.TB, pattern, typ string, der []byte) string {
+	t.Helper()
+
+	f, err := os.CreateTemp(ca.dir, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: typ, Bytes: der}); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func newKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newSerial(t testing.TB) *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serial
+}
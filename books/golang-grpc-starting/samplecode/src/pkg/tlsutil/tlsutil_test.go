@@ -0,0 +1,168 @@
+package tlsutil_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"mygrpc/internal/grpctest"
+	"mygrpc/pkg/tlsutil"
+	"mygrpc/pkg/tlsutil/tlstest"
+)
+
+func startServer(t *testing.T, conf tlsutil.ServerConfig) *grpctest.Server {
+	t.Helper()
+
+	tlsConf, err := tlsutil.NewServerTLSConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return grpctest.NewServer(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, health.NewServer())
+	}, grpc.Creds(credentials.NewTLS(tlsConf)))
+}
+
+func check(t *testing.T, s *grpctest.Server, conf tlsutil.ClientConfig) error {
+	t.Helper()
+
+	tlsConf, err := tlsutil.NewClientTLSConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := s.Dial(t, grpc.WithTransportCredentials(credentials.NewTLS(tlsConf)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestTLS(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	server := ca.IssueServer(t, "mygrpc.local")
+	s := startServer(t, tlsutil.ServerConfig{CertFile: server.CertFile, KeyFile: server.KeyFile})
+
+	if err := check(t, s, tlsutil.ClientConfig{CAFile: ca.CertFile, ServerName: "mygrpc.local"}); err != nil {
+		t.Errorf("trusted server: %v", err)
+	}
+	if err := check(t, s, tlsutil.ClientConfig{CAFile: ca.CertFile, ServerName: "other.local"}); err == nil {
+		t.Error("expected server name mismatch error")
+	}
+	if err := check(t, s, tlsutil.ClientConfig{CAFile: tlstest.NewCA(t).CertFile, ServerName: "mygrpc.local"}); err == nil {
+		t.Error("expected unknown authority error")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	server := ca.IssueServer(t, "mygrpc.local")
+	s := startServer(t, tlsutil.ServerConfig{
+		CertFile:     server.CertFile,
+		KeyFile:      server.KeyFile,
+		ClientCAFile: ca.CertFile,
+	})
+
+	client := ca.IssueClient(t, "client")
+	if err := check(t, s, tlsutil.ClientConfig{
+		CAFile:     ca.CertFile,
+		CertFile:   client.CertFile,
+		KeyFile:    client.KeyFile,
+		ServerName: "mygrpc.local",
+	}); err != nil {
+		t.Errorf("client with certificate: %v", err)
+	}
+
+	if err := check(t, s, tlsutil.ClientConfig{CAFile: ca.CertFile, ServerName: "mygrpc.local"}); err == nil {
+		t.Error("expected error for client without certificate")
+	}
+
+	other := tlstest.NewCA(t).IssueClient(t, "stranger")
+	if err := check(t, s, tlsutil.ClientConfig{
+		CAFile:     ca.CertFile,
+		CertFile:   other.CertFile,
+		KeyFile:    other.KeyFile,
+		ServerName: "mygrpc.local",
+	}); err == nil {
+		t.Error("expected error for client certificate from unknown CA")
+	}
+}
+
+func TestReload(t *testing.T) {
+	oldCA := tlstest.NewCA(t)
+	server := oldCA.IssueServer(t, "mygrpc.local")
+	s := startServer(t, tlsutil.ServerConfig{CertFile: server.CertFile, KeyFile: server.KeyFile})
+
+	newCA := tlstest.NewCA(t)
+	if err := check(t, s, tlsutil.ClientConfig{CAFile: newCA.CertFile, ServerName: "mygrpc.local"}); err == nil {
+		t.Fatal("expected error before rotation")
+	}
+
+	// 稼働中のサーバーの証明書ファイルを新しいCAが発行したものに置き換える
+	rotated := newCA.IssueServer(t, "mygrpc.local")
+	copyFile(t, rotated.CertFile, server.CertFile)
+	copyFile(t, rotated.KeyFile, server.KeyFile)
+
+	if err := check(t, s, tlsutil.ClientConfig{CAFile: newCA.CertFile, ServerName: "mygrpc.local"}); err != nil {
+		t.Errorf("after rotation: %v", err)
+	}
+	if err := check(t, s, tlsutil.ClientConfig{CAFile: oldCA.CertFile, ServerName: "mygrpc.local"}); err == nil {
+		t.Error("expected old CA to be rejected after rotation")
+	}
+}
+
+func TestHalfConfigured(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	server := ca.IssueServer(t, "mygrpc.local")
+	client := ca.IssueClient(t, "client")
+
+	// どれか1つでも指定されていればTLSが有効になり、足りないファイルはエラーになる
+	servers := []tlsutil.ServerConfig{
+		{ClientCAFile: ca.CertFile},
+		{CertFile: server.CertFile, ClientCAFile: ca.CertFile},
+		{KeyFile: server.KeyFile},
+	}
+	for _, conf := range servers {
+		if !conf.Enabled() {
+			t.Errorf("%+v: Enabled() = false", conf)
+		}
+		if _, err := tlsutil.NewServerTLSConfig(conf); err == nil {
+			t.Errorf("%+v: NewServerTLSConfig succeeded", conf)
+		}
+	}
+
+	clients := []tlsutil.ClientConfig{
+		{KeyFile: client.KeyFile},
+		{CertFile: client.CertFile},
+		{CAFile: ca.CertFile, KeyFile: client.KeyFile},
+	}
+	for _, conf := range clients {
+		if !conf.Enabled() {
+			t.Errorf("%+v: Enabled() = false", conf)
+		}
+		if _, err := tlsutil.NewClientTLSConfig(conf); err == nil {
+			t.Errorf("%+v: NewClientTLSConfig succeeded", conf)
+		}
+	}
+
+	if (tlsutil.ServerConfig{}).Enabled() || (tlsutil.ClientConfig{}).Enabled() {
+		t.Error("empty config is enabled")
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+
+	b, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+package tlsutil
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// fileWatcher はファイルから読み込んだ値をキャッシュし、
+// ファイルが更新されていたら次にgetされたときに読み込み直す
+type fileWatcher[T any] struct {
+	paths []string
+	load  func() (T, error)
+
+	mu     sync.Mutex
+	stamps []fileStamp
+	value  T
+}
+
+func newFileWatcher[T any](load func() (T, error), paths ...string) (*fileWatcher[T], error) {
+	w := &fileWatcher[T]{paths: paths, load: load}
+	w.stamps = w.stat()
+	v, err := load()
+	if err != nil {
+		return nil, err
+	}
+	w.value = v
+	return w, nil
+}
+
+// get は現在の値を返す
+// 再読み込みに失敗した場合は、ローテーション途中の可能性があるので直前の値を使い続ける
+func (w *fileWatcher[T]) get() T {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stamps := w.stat()
+	if !w.changed(stamps) {
+		return w.value
+	}
+
+	v, err := w.load()
+	if err != nil {
+		log.Printf("tlsutil: keep using the previous certificate: %v", err)
+		return w.value
+	}
+	w.value = v
+	w.stamps = stamps
+	return w.value
+}
+
+func (w *fileWatcher[T]) stat() []fileStamp {
+	stamps := make([]fileStamp, len(w.paths))
+	for i, p := range w.paths {
+		if fi, err := os.Stat(p); err == nil {
+			stamps[i] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
+
+func (w *fileWatcher[T]) changed(stamps []fileStamp) bool {
+	for i := range stamps {
+		if !stamps[i].modTime.Equal(w.stamps[i].modTime) || stamps[i].size != w.stamps[i].size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Exporter receives finished spans.
+type Exporter interface {
+	ExportSpan(Span)
+}
+
+// WriterExporter writes each span as one line of JSON.
+type WriterExporter struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// NewWriterExporter returns an Exporter that writes to w, such as os.Stdout.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// NewFileExporter returns an Exporter that appends to the file at path.
+// "-" means stdout.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	if path == "-" {
+		return NewWriterExporter(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	e := NewWriterExporter(f)
+	e.closer = f
+	return e, nil
+}
+
+// ExportSpan implements Exporter.
+func (e *WriterExporter) ExportSpan(s Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// 書き込みに失敗してもRPCは止めない
+	e.enc.Encode(s)
+}
+
+// Close closes the underlying file, if the exporter opened one.
+func (e *WriterExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closer.Close()
+}
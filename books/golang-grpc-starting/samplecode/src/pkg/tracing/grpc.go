@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor returns an interceptor that starts a client span and
+// sends its trace context and the request ID in the outgoing metadata.
+func (t *Tracer) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := t.startClient(ctx, method)
+		err := invoker(ctx, method, req, res, cc, opts...)
+		span.End(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that starts a client span
+// for each stream. The span ends when the stream does, or when the context of
+// the stream is canceled or times out.
+func (t *Tracer) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := t.startClient(ctx, method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			span.End(err)
+			return nil, err
+		}
+		stream := &clientStream{ClientStream: cs, span: span, serverStreams: desc.ServerStreams}
+		go stream.endOnCancel(ctx)
+		return stream, nil
+	}
+}
+
+// startClient はリクエストIDとトレースコンテキストをメタデータに載せる
+// 呼び出し元がすでにリクエストIDを決めていればそれを引き継ぐ
+func (t *Tracer) startClient(ctx context.Context, method string) (context.Context, *ActiveSpan) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+
+	id := RequestIDFromContext(ctx)
+	if v := md.Get(RequestIDKey); id == "" && len(v) > 0 {
+		id = v[0]
+	}
+	if id == "" {
+		id = NewRequestID()
+	}
+	ctx = ContextWithRequestID(ctx, id)
+
+	ctx, span := t.Start(ctx, method, KindClient)
+	md.Set(RequestIDKey, id)
+	md.Set(TraceparentKey, span.SpanContext().Traceparent())
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	span          *ActiveSpan
+	serverStreams bool
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if errors.Is(err, io.EOF) {
+		s.span.End(nil)
+	} else if err != nil {
+		s.span.End(err)
+	} else if !s.serverStreams {
+		// クライアントストリーミングの応答は1件だけなので、受け取った時点で終わる
+		s.span.End(nil)
+	}
+	return err
+}
+
+// endOnCancel はctxがキャンセルされたりタイムアウトしたりしたときにスパンを終える
+// 呼び出し側が最後まで受信せずにやめたストリームでも、RecvMsgを待たずに終わるようにする
+// ストリームのコンテキストはctxから作られ、ストリームが終わるとキャンセルされるので、このゴルーチンは残らない
+func (s *clientStream) endOnCancel(ctx context.Context) {
+	<-s.ClientStream.Context().Done()
+	if err := ctx.Err(); err != nil {
+		s.span.End(status.FromContextError(err).Err())
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor that continues the trace sent
+// by the client, starts a server span and echoes the request ID in the
+// response header.
+func (t *Tracer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := t.startServer(ctx, info.FullMethod)
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, RequestIDFromContext(ctx)))
+		res, err := handler(ctx, req) // 本来の処理
+		span.End(err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func (t *Tracer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := t.startServer(ss.Context(), info.FullMethod)
+		ss.SetHeader(metadata.Pairs(RequestIDKey, RequestIDFromContext(ctx)))
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx}) // 本来のストリーム処理
+		span.End(err)
+		return err
+	}
+}
+
+func (t *Tracer) startServer(ctx context.Context, method string) (context.Context, *ActiveSpan) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if v := md.Get(TraceparentKey); len(v) > 0 {
+		// 不正なtraceparentは無視して新しいトレースを始める
+		if sc, err := ParseTraceparent(v[0]); err == nil {
+			ctx = ContextWithSpanContext(ctx, sc)
+		}
+	}
+
+	id := ""
+	if v := md.Get(RequestIDKey); len(v) > 0 && v[0] != "" {
+		id = v[0]
+	} else {
+		// 後続のインターセプターやハンドラーがメタデータから読めるように、生成したIDを足しておく
+		id = NewRequestID()
+		md = md.Copy()
+		md.Set(RequestIDKey, id)
+		ctx = metadata.NewIncomingContext(ctx, md)
+	}
+	ctx = ContextWithRequestID(ctx, id)
+
+	return t.Start(ctx, method, KindServer)
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogHandler adds the trace_id, span_id and request_id of the context to every
+// record, so that the logs of a client and a server can be joined with the
+// exported spans.
+type LogHandler struct {
+	inner slog.Handler
+}
+
+// NewLogHandler wraps h.
+func NewLogHandler(h slog.Handler) *LogHandler {
+	return &LogHandler{inner: h}
+}
+
+// Enabled implements slog.Handler.
+func (h *LogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *LogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		r = r.Clone()
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID.String()),
+			slog.String("span_id", sc.SpanID.String()),
+		)
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{inner: h.inner.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler.
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{inner: h.inner.WithGroup(name)}
+}
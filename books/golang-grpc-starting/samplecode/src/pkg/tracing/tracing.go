@@ -0,0 +1,254 @@
+// Package tracing propagates W3C trace context and request IDs between gRPC
+// clients and servers, and records the spans of each RPC so that client and
+// server logs can be correlated offline.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// TraceparentKey is the metadata key of the W3C trace context.
+	TraceparentKey = "traceparent"
+	// RequestIDKey is the metadata key of the request ID. The server echoes it
+	// in the response header.
+	RequestIDKey = "x-request-id"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether t is not all zeros.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether s is not all zeros.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that is propagated across processes.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a traceparent header value.
+// Future versions are accepted as long as they start with the version 00 fields.
+func ParseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, fmt.Errorf("tracing: malformed traceparent %q", s)
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("tracing: unsupported traceparent version %q", version)
+	}
+
+	var sc SpanContext
+	if err := decodeHex(sc.TraceID[:], traceID); err != nil {
+		return SpanContext{}, fmt.Errorf("tracing: trace-id: %w", err)
+	}
+	if err := decodeHex(sc.SpanID[:], spanID); err != nil {
+		return SpanContext{}, fmt.Errorf("tracing: parent-id: %w", err)
+	}
+	var f [1]byte
+	if err := decodeHex(f[:], flags); err != nil {
+		return SpanContext{}, fmt.Errorf("tracing: trace-flags: %w", err)
+	}
+	sc.Sampled = f[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("tracing: all zero ids in %q", s)
+	}
+	return sc, nil
+}
+
+// decodeHex は大文字を許さずにちょうどlen(dst)バイト分の16進数を読む
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("invalid hex %q", s)
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	rand.Read(t[:])
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	rand.Read(s[:])
+	return s
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Span kinds.
+const (
+	KindClient = "client"
+	KindServer = "server"
+)
+
+// Span is a finished span handed to an Exporter.
+type Span struct {
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	RequestID    string            `json:"request_id,omitempty"`
+	Name         string            `json:"name"`
+	Kind         string            `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Code         string            `json:"code"`
+	Message      string            `json:"message,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+// ActiveSpan is a span that has been started but not ended yet.
+type ActiveSpan struct {
+	tracer *Tracer
+	sc     SpanContext
+
+	mu   sync.Mutex
+	span Span
+	done bool
+}
+
+// SpanContext returns the propagated part of the span.
+func (s *ActiveSpan) SpanContext() SpanContext {
+	return s.sc
+}
+
+// SetAttribute records a key-value pair on the span.
+func (s *ActiveSpan) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.span.Attributes == nil {
+		s.span.Attributes = make(map[string]string)
+	}
+	s.span.Attributes[key] = value
+}
+
+// End finishes the span with the status of err and exports it.
+// Calls after the first one are ignored.
+func (s *ActiveSpan) End(err error) {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	stat := status.Convert(err)
+	s.span.End = time.Now()
+	s.span.Code = stat.Code().String()
+	if stat.Code() != codes.OK {
+		s.span.Message = stat.Message()
+	}
+	span := s.span
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil && s.sc.Sampled {
+		s.tracer.exporter.ExportSpan(span)
+	}
+}
+
+// Tracer starts spans and hands the finished ones to an Exporter.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a Tracer that exports to e.
+// A nil Exporter still propagates the trace context but records nothing.
+func NewTracer(e Exporter) *Tracer {
+	return &Tracer{exporter: e}
+}
+
+// Start starts a span as a child of the span in ctx, or as the root of a new
+// trace if ctx has none. The returned context carries the new span.
+func (t *Tracer) Start(ctx context.Context, name, kind string) (context.Context, *ActiveSpan) {
+	parent, hasParent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: true}
+	if hasParent {
+		sc.TraceID, sc.Sampled = parent.TraceID, parent.Sampled
+	}
+
+	span := &ActiveSpan{
+		tracer: t,
+		sc:     sc,
+		span: Span{
+			TraceID:   sc.TraceID.String(),
+			SpanID:    sc.SpanID.String(),
+			RequestID: RequestIDFromContext(ctx),
+			Name:      name,
+			Kind:      kind,
+			Start:     time.Now(),
+		},
+	}
+	if hasParent {
+		span.span.ParentSpanID = parent.SpanID.String()
+	}
+	return ContextWithSpanContext(ctx, sc), span
+}
+
+type spanContextKey struct{}
+type requestIDKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx that carries sc.
+// Use it to continue a trace received from outside of gRPC.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, if any.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// ContextWithRequestID returns a copy of ctx that carries the request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
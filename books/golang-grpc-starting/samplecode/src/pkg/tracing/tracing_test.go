@@ -0,0 +1,221 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"mygrpc/internal/grpctest"
+	hellopb "mygrpc/pkg/grpc"
+	"mygrpc/pkg/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr bool
+		sampled bool
+	}{
+		{in: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sampled: true},
+		{in: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", sampled: false},
+		{in: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", sampled: true},
+		{in: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{in: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{in: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{in: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{in: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba9-01", wantErr: true},
+		{in: "garbage", wantErr: true},
+	}
+	for _, tt := range tests {
+		sc, err := tracing.ParseTraceparent(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTraceparent(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if sc.Sampled != tt.sampled {
+			t.Errorf("ParseTraceparent(%q) sampled = %v, want %v", tt.in, sc.Sampled, tt.sampled)
+		}
+		if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+			t.Errorf("ParseTraceparent(%q) = %v", tt.in, sc)
+		}
+	}
+
+	sc, _ := tracing.ParseTraceparent(tests[0].in)
+	if got := sc.Traceparent(); got != tests[0].in {
+		t.Errorf("Traceparent() = %q, want %q", got, tests[0].in)
+	}
+}
+
+// chanExporter は終わったスパンをチャネルに送る
+type chanExporter chan tracing.Span
+
+func (e chanExporter) ExportSpan(s tracing.Span) {
+	e <- s
+}
+
+func TestStreamCancel(t *testing.T) {
+	spans := make(chanExporter, 1)
+	tracer := tracing.NewTracer(spans)
+
+	s := grpctest.NewServer(t, func(s *grpc.Server) {
+		hellopb.RegisterGreetingServiceServer(s, &greetingServer{logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	})
+	conn := s.Dial(t, grpc.WithChainStreamInterceptor(tracer.StreamClientInterceptor()))
+
+	// 1件だけ受信してやめると、RecvMsgはio.EOFもエラーも返さない
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := hellopb.NewGreetingServiceClient(conn).HelloServerStream(ctx, &hellopb.HelloRequest{Name: "gopher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case span := <-spans:
+		if span.Code != codes.Canceled.String() {
+			t.Errorf("code = %s, want Canceled", span.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("span of the canceled stream did not end")
+	}
+}
+
+type greetingServer struct {
+	hellopb.UnimplementedGreetingServiceServer
+	logger *slog.Logger
+}
+
+func (s *greetingServer) Hello(ctx context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
+	s.logger.InfoContext(ctx, "hello")
+	return &hellopb.HelloResponse{Message: "Hello, " + req.GetName() + "!"}, nil
+}
+
+func (s *greetingServer) HelloServerStream(req *hellopb.HelloRequest, stream hellopb.GreetingService_HelloServerStreamServer) error {
+	s.logger.InfoContext(stream.Context(), "stream")
+	for i := 0; i < 2; i++ {
+		if err := stream.Send(&hellopb.HelloResponse{Message: req.GetName()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSpans(t *testing.T, buf *bytes.Buffer) []tracing.Span {
+	t.Helper()
+	var spans []tracing.Span
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var s tracing.Span
+		if err := dec.Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+func TestPropagation(t *testing.T) {
+	var serverSpans, clientSpans, logs bytes.Buffer
+	serverTracer := tracing.NewTracer(tracing.NewWriterExporter(&serverSpans))
+	clientTracer := tracing.NewTracer(tracing.NewWriterExporter(&clientSpans))
+	logger := slog.New(tracing.NewLogHandler(slog.NewJSONHandler(&logs, nil)))
+
+	s := grpctest.NewServer(t, func(s *grpc.Server) {
+		hellopb.RegisterGreetingServiceServer(s, &greetingServer{logger: logger})
+	},
+		grpc.ChainUnaryInterceptor(serverTracer.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(serverTracer.StreamServerInterceptor()),
+	)
+	client := hellopb.NewGreetingServiceClient(s.Dial(t,
+		grpc.WithChainUnaryInterceptor(clientTracer.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(clientTracer.StreamClientInterceptor()),
+	))
+
+	// 呼び出し元のトレースを引き継ぐ
+	parent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := tracing.ContextWithSpanContext(context.Background(), parent)
+
+	var header metadata.MD
+	if _, err := client.Hello(ctx, &hellopb.HelloRequest{Name: "gopher"}, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+
+	// リクエストIDを指定すると、そのままサーバーに届いて返ってくる
+	ctx = metadata.AppendToOutgoingContext(context.Background(), tracing.RequestIDKey, "req-stream")
+	stream, err := client.HelloServerStream(ctx, &hellopb.HelloRequest{Name: "gopher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	streamHeader, _ := stream.Header()
+	s.GracefulStop()
+
+	cs, ss := readSpans(t, &clientSpans), readSpans(t, &serverSpans)
+	if len(cs) != 2 || len(ss) != 2 {
+		t.Fatalf("got %d client and %d server spans, want 2 each", len(cs), len(ss))
+	}
+
+	// unary: 呼び出し元 -> クライアント -> サーバーの親子関係になる
+	if cs[0].TraceID != parent.TraceID.String() || cs[0].ParentSpanID != parent.SpanID.String() {
+		t.Errorf("client span = %+v, want a child of %v", cs[0], parent)
+	}
+	if ss[0].TraceID != cs[0].TraceID || ss[0].ParentSpanID != cs[0].SpanID {
+		t.Errorf("server span = %+v, want a child of the client span %s", ss[0], cs[0].SpanID)
+	}
+	if ss[0].Kind != tracing.KindServer || cs[0].Kind != tracing.KindClient {
+		t.Errorf("kinds = %s, %s", cs[0].Kind, ss[0].Kind)
+	}
+	if id := header.Get(tracing.RequestIDKey); len(id) != 1 || id[0] != cs[0].RequestID || id[0] != ss[0].RequestID {
+		t.Errorf("echoed request id = %v, client %q, server %q", id, cs[0].RequestID, ss[0].RequestID)
+	}
+
+	// stream: 新しいトレースとして始まり、指定したリクエストIDが使われる
+	if cs[1].ParentSpanID != "" || ss[1].ParentSpanID != cs[1].SpanID {
+		t.Errorf("stream spans = %+v, %+v", cs[1], ss[1])
+	}
+	if got := streamHeader.Get(tracing.RequestIDKey); len(got) != 1 || got[0] != "req-stream" {
+		t.Errorf("echoed request id = %v, want req-stream", got)
+	}
+	if ss[1].RequestID != "req-stream" || cs[1].Code != "OK" || ss[1].Code != "OK" {
+		t.Errorf("stream spans = %+v, %+v", cs[1], ss[1])
+	}
+
+	// サーバーのログにはサーバースパンのIDが付く
+	var records []map[string]any
+	dec := json.NewDecoder(&logs)
+	for dec.More() {
+		var r map[string]any
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d log records, want 2", len(records))
+	}
+	for i, r := range records {
+		if r["trace_id"] != ss[i].TraceID || r["span_id"] != ss[i].SpanID || r["request_id"] != ss[i].RequestID {
+			t.Errorf("log %d = %v, want ids of %+v", i, r, ss[i])
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"slogger/ctxkey"
+
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+func main() { unitchecker.Main(ctxkey.Analyzer) }
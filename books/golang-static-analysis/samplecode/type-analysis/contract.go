@@ -0,0 +1,250 @@
+package slogger
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// checkRecordMutation はHandleメソッドが受け取ったslog.Recordを変更したうえで、
+// 保持したり複数のハンドラに渡したりしていないかを検査する
+// Recordは属性のスライスを共有しているので、そうする場合は先にClone()する必要がある
+func checkRecordMutation(pass *analysis.Pass, inspect *inspector.Inspector, slogHandler *types.Interface, handleFunc *types.Func) {
+	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		fd := n.(*ast.FuncDecl)
+		if fd.Body == nil || fd.Name.Name != handleFunc.Name() {
+			return
+		}
+		fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+		if !ok || !isHandlerMethod(fn, slogHandler, handleFunc) {
+			return
+		}
+		record := fn.Signature().Params().At(1)
+		if record.Name() == "" || record.Name() == "_" {
+			return
+		}
+
+		u := recordUses(pass, fd.Body, record, handleFunc)
+		if !u.mutated.IsValid() || u.cloned || (!u.retained && u.sinks < 2) {
+			return
+		}
+		pass.Reportf(u.mutated, "%s.Handle modifies the record %s that it retains or passes to multiple handlers; call %s.Clone() first",
+			namedOf(fn.Signature().Recv().Type()).Obj().Name(), record.Name(), record.Name())
+	})
+}
+
+// isHandlerMethod はfnがslog.Handlerを実装する型のメソッドで、mと同じシグネチャかどうかを返す
+func isHandlerMethod(fn *types.Func, slogHandler *types.Interface, m *types.Func) bool {
+	recv := fn.Signature().Recv()
+	if recv == nil || !types.Identical(fn.Signature(), m.Signature()) {
+		return false
+	}
+	named := namedOf(recv.Type())
+	if named == nil {
+		return false
+	}
+	return types.Implements(named, slogHandler) || types.Implements(types.NewPointer(named), slogHandler)
+}
+
+// recordUse はHandleの中でのRecordの使われ方
+type recordUse struct {
+	mutated  token.Pos // 最初にAddAttrsまたはAddを呼んだ位置
+	cloned   bool      // r = r.Clone() で複製し直している
+	retained bool      // フィールドやスライス、チャネル、クロージャなどに保持している
+	sinks    int       // ハンドラのHandleに渡している回数。ループの中なら複数回と数える
+}
+
+func recordUses(pass *analysis.Pass, body *ast.BlockStmt, record *types.Var, handleFunc *types.Func) recordUse {
+	var u recordUse
+	var stack []ast.Node
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+
+		id, ok := n.(*ast.Ident)
+		if !ok || pass.TypesInfo.Uses[id] != record || len(stack) < 2 {
+			return true
+		}
+		for _, anc := range stack {
+			if _, ok := anc.(*ast.FuncLit); ok {
+				u.retained = true
+			}
+		}
+
+		switch parent := stack[len(stack)-2].(type) {
+		case *ast.SelectorExpr:
+			// r.AddAttrs(...) や r.Add(...) はRecordを変更する
+			call, ok := grandparent(stack).(*ast.CallExpr)
+			if ok && call.Fun == parent && (parent.Sel.Name == "AddAttrs" || parent.Sel.Name == "Add") && !u.mutated.IsValid() {
+				u.mutated = call.Pos()
+			}
+		case *ast.CallExpr:
+			if parent.Fun == id {
+				break
+			}
+			if b, ok := pass.TypesInfo.Uses[identOf(parent.Fun)].(*types.Builtin); ok && b.Name() == "append" {
+				u.retained = true
+				break
+			}
+			if g, ok := grandparent(stack).(*ast.GoStmt); ok && g.Call == parent {
+				u.retained = true
+				break
+			}
+			if !isMethodCall(pass, parent, handleFunc) {
+				break
+			}
+			u.sinks++
+			if inLoop(stack) {
+				u.sinks++
+			}
+		case *ast.CompositeLit, *ast.KeyValueExpr, *ast.SendStmt:
+			u.retained = true
+		case *ast.AssignStmt:
+			for _, lhs := range parent.Lhs {
+				if lhs == id {
+					u.cloned = u.cloned || isCloneOf(pass, parent.Rhs, record)
+					return true
+				}
+			}
+			for _, lhs := range parent.Lhs {
+				if _, ok := lhs.(*ast.Ident); !ok {
+					u.retained = true
+				}
+			}
+		}
+		return true
+	})
+	return u
+}
+
+func grandparent(stack []ast.Node) ast.Node {
+	if len(stack) < 3 {
+		return nil
+	}
+	return stack[len(stack)-3]
+}
+
+func identOf(expr ast.Expr) *ast.Ident {
+	id, _ := ast.Unparen(expr).(*ast.Ident)
+	return id
+}
+
+// inLoop はスタックの中にfor文があるかどうかを返す
+func inLoop(stack []ast.Node) bool {
+	for _, n := range stack {
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return true
+		}
+	}
+	return false
+}
+
+// isCloneOf はrhsが record.Clone() かどうかを返す
+func isCloneOf(pass *analysis.Pass, rhs []ast.Expr, record *types.Var) bool {
+	if len(rhs) != 1 {
+		return false
+	}
+	call, ok := rhs[0].(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Clone" {
+		return false
+	}
+	id := identOf(sel.X)
+	return id != nil && pass.TypesInfo.Uses[id] == record
+}
+
+// checkEnabledDelegation はslog.Handlerを埋め込んでHandleを上書きした型が、
+// 自身のEnabledで埋め込んだハンドラのEnabledを呼んでいるかを検査する
+// 呼んでいないと、埋め込んだハンドラが無効にしているレベルのログもHandleに渡ってしまう
+func checkEnabledDelegation(pass *analysis.Pass, inspect *inspector.Inspector, slogHandler *types.Interface, handleFunc, enabledFunc *types.Func) {
+	methods := make(map[*types.TypeName]map[string]*ast.FuncDecl)
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil || fd.Body == nil {
+				continue
+			}
+			fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			named := namedOf(fn.Signature().Recv().Type())
+			if named == nil {
+				continue
+			}
+			obj := named.Origin().Obj()
+			if methods[obj] == nil {
+				methods[obj] = make(map[string]*ast.FuncDecl)
+			}
+			methods[obj][fd.Name.Name] = fd
+		}
+	}
+
+	inspect.Preorder([]ast.Node{(*ast.TypeSpec)(nil)}, func(n ast.Node) {
+		ts := n.(*ast.TypeSpec)
+		obj, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName)
+		if !ok || obj.IsAlias() {
+			return
+		}
+		named, ok := obj.Type().(*types.Named)
+		if !ok {
+			return
+		}
+		st, ok := named.Underlying().(*types.Struct)
+		if !ok || embeddedHandler(st, slogHandler) == nil {
+			return
+		}
+
+		// Enabledが埋め込んだslog.Handlerから昇格しているなら、そのまま委譲されている
+		handle, enabled := methods[obj][handleFunc.Name()], methods[obj][enabledFunc.Name()]
+		if handle == nil || enabled == nil {
+			return
+		}
+		if !isHandlerMethod(pass.TypesInfo.Defs[handle.Name].(*types.Func), slogHandler, handleFunc) ||
+			!isHandlerMethod(pass.TypesInfo.Defs[enabled.Name].(*types.Func), slogHandler, enabledFunc) {
+			return
+		}
+		// Handleの中で確認していてもよい
+		if callsInterfaceMethod(pass, enabled.Body, enabledFunc) || callsInterfaceMethod(pass, handle.Body, enabledFunc) {
+			return
+		}
+		pass.Reportf(enabled.Name.Pos(), "%s overrides Handle but its Enabled does not call Enabled of the embedded slog.Handler", obj.Name())
+	})
+}
+
+// isMethodCall はcallがmと同じ名前とシグネチャのメソッドの呼び出しかどうかを返す
+func isMethodCall(pass *analysis.Pass, call *ast.CallExpr, m *types.Func) bool {
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	fn, ok := pass.TypesInfo.Uses[sel.Sel].(*types.Func)
+	return ok && fn.Name() == m.Name() && types.Identical(fn.Signature(), m.Signature())
+}
+
+// callsInterfaceMethod はbodyがインターフェースのメソッドmを呼んでいるかどうかを返す
+func callsInterfaceMethod(pass *analysis.Pass, body *ast.BlockStmt, m *types.Func) bool {
+	var found bool
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || found || !isMethodCall(pass, call, m) {
+			return !found
+		}
+		fn := pass.TypesInfo.Uses[ast.Unparen(call.Fun).(*ast.SelectorExpr).Sel].(*types.Func)
+		if recv := fn.Signature().Recv(); recv != nil && types.IsInterface(recv.Type()) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
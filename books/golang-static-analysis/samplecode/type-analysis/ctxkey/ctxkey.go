@@ -0,0 +1,228 @@
+package ctxkey
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+
+	"slogger/internal/passutil"
+)
+
+const doc = "ctxkey reports context keys of built-in or exported types"
+
+// Analyzer reports context.WithValue and Context.Value calls whose key has
+// a built-in type such as string, or an exported type. Such keys can
+// collide with the keys of other packages.
+var Analyzer = &analysis.Analyzer{
+	Name: "ctxkey",
+	Doc:  doc,
+	Run:  run,
+	Requires: []*analysis.Analyzer{
+		inspect.Analyzer,
+	},
+}
+
+// keyUse はキーを検査する呼び出し
+type keyUse struct {
+	key  ast.Expr
+	typ  types.Type
+	file *ast.File
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	// context.Contextの型情報を取得
+	var ctxIface *types.Interface
+	for _, p := range pass.Pkg.Imports() {
+		if p.Path() == "context" {
+			ctxIface, _ = p.Scope().Lookup("Context").Type().Underlying().(*types.Interface)
+		}
+	}
+	if ctxIface == nil {
+		return nil, nil
+	}
+
+	nodeFilter := []ast.Node{
+		(*ast.CallExpr)(nil),
+	}
+
+	var uses []keyUse
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return
+		}
+		key := keyArg(pass, call, ctxIface)
+		if key == nil {
+			return
+		}
+		typ := pass.TypesInfo.TypeOf(key)
+		if typ == nil || !badKeyType(typ) {
+			return
+		}
+		uses = append(uses, keyUse{key: key, typ: typ, file: passutil.FileOf(pass, call.Pos())})
+	})
+
+	// 同じキーの型は、最初に使われたファイルにまとめて宣言する
+	names := keyTypeNames(pass, uses)
+	declFile := make(map[string]*ast.File)
+	for _, u := range uses {
+		if name := names[constValue(pass, u.key)]; name != "" && declFile[name] == nil {
+			declFile[name] = u.file
+		}
+	}
+
+	for _, u := range uses {
+		diag := analysis.Diagnostic{
+			Pos:     u.key.Pos(),
+			End:     u.key.End(),
+			Message: message(pass, u.typ),
+		}
+		if name := names[constValue(pass, u.key)]; name != "" {
+			diag.SuggestedFixes = suggestKeyType(u.key, name, declFile[name])
+		}
+		pass.Report(diag)
+	}
+
+	return nil, nil
+}
+
+// keyArg はcallがcontext.WithValueまたはContextのValueメソッドの呼び出しなら、キーの引数を返す
+func keyArg(pass *analysis.Pass, call *ast.CallExpr, ctxIface *types.Interface) ast.Expr {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok {
+		return nil
+	}
+	if fn.Pkg() != nil && fn.Pkg().Path() == "context" && fn.Name() == "WithValue" && len(call.Args) == 3 {
+		return call.Args[1]
+	}
+	if fn.Name() != "Value" || len(call.Args) != 1 {
+		return nil
+	}
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	recv := pass.TypesInfo.TypeOf(sel.X)
+	if recv == nil || !types.Implements(recv, ctxIface) {
+		return nil
+	}
+	return call.Args[0]
+}
+
+// badKeyType はtypが組み込みの型またはエクスポートされた型かどうかを返す
+// nilは型がないので報告しない。nilのキーはcontext.WithValueが実行時にpanicする
+func badKeyType(typ types.Type) bool {
+	switch t := types.Unalias(typ).(type) {
+	case *types.Basic:
+		return t.Kind() != types.UntypedNil
+	case *types.Named:
+		return t.Obj().Exported()
+	}
+	return false
+}
+
+func message(pass *analysis.Pass, typ types.Type) string {
+	qf := types.RelativeTo(pass.Pkg)
+	if b, ok := types.Unalias(typ).(*types.Basic); ok {
+		return fmt.Sprintf("context key has built-in type %s; use a value of an unexported type", types.Default(b))
+	}
+	return fmt.Sprintf("context key has exported type %s; use a value of an unexported type", types.TypeString(typ, qf))
+}
+
+// constValue はkeyが組み込みの文字列型の定数なら、その値を返す
+func constValue(pass *analysis.Pass, key ast.Expr) string {
+	tv, ok := pass.TypesInfo.Types[key]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return ""
+	}
+	if _, ok := types.Unalias(tv.Type).(*types.Basic); !ok {
+		return ""
+	}
+	return constant.StringVal(tv.Value)
+}
+
+// keyTypeNames は文字列のキーごとに、置き換える非公開の型の名前を決める
+// "userID"ならuserIDKeyになる。識別子にできない文字列や、
+// 別の文字列と同じ名前になるもの、パッケージ内の別の宣言と衝突するものには修正を提案しない
+func keyTypeNames(pass *analysis.Pass, uses []keyUse) map[string]string {
+	names := make(map[string]string)
+	values := make(map[string]map[string]bool)
+	for _, u := range uses {
+		v := constValue(pass, u.key)
+		name := keyTypeName(v)
+		if name == "" {
+			continue
+		}
+		if values[name] == nil {
+			values[name] = make(map[string]bool)
+		}
+		values[name][v] = true
+		names[v] = name
+	}
+	for v, name := range names {
+		if len(values[name]) > 1 || pass.Pkg.Scope().Lookup(name) != nil {
+			delete(names, v)
+		}
+	}
+	return names
+}
+
+func keyTypeName(v string) string {
+	if !token.IsIdentifier(v) {
+		return ""
+	}
+	r, size := utf8.DecodeRuneInString(v)
+	name := string(unicode.ToLower(r)) + v[size:] + "Key"
+	if !token.IsIdentifier(name) || ast.IsExported(name) {
+		return ""
+	}
+	return name
+}
+
+// suggestKeyType はキーをname{}に置き換え、fileにnameの型を宣言する修正を返す
+func suggestKeyType(key ast.Expr, name string, file *ast.File) []analysis.SuggestedFix {
+	if file == nil {
+		return nil
+	}
+	pos := declPos(file)
+	return []analysis.SuggestedFix{{
+		Message: fmt.Sprintf("Use unexported key type %s", name),
+		TextEdits: []analysis.TextEdit{
+			{
+				Pos:     pos,
+				End:     pos,
+				NewText: []byte(fmt.Sprintf("\n\ntype %s struct{}", name)),
+			},
+			{
+				Pos:     key.Pos(),
+				End:     key.End(),
+				NewText: []byte(name + "{}"),
+			},
+		},
+	}}
+}
+
+// declPos は型を宣言する位置を返す
+// import宣言の後ろ、なければpackage句の後ろに追加する
+func declPos(file *ast.File) token.Pos {
+	pos := file.Name.End()
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			break
+		}
+		pos = gd.End()
+	}
+	return pos
+}
@@ -0,0 +1,146 @@
+package ctxkey_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"slogger/ctxkey"
+
+	"github.com/gostaticanalysis/testutil"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// TestAnalyzer is a test for Analyzer.
+func TestAnalyzer(t *testing.T) {
+	testdata := testutil.WithModules(t, analysistest.TestData(), nil)
+	analysistest.Run(t, testdata, ctxkey.Analyzer, "keys")
+}
+
+// samples is the sample code of the golang-context book.
+const samples = "../../../../golang-context/samplecode"
+
+// TestSamples runs Analyzer on the sample code of the golang-context book
+// and checks the fixes against testdata/golden.
+func TestSamples(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string // samplesからの相対パス
+		// files は解析するファイル。空ならdirのすべてのファイル
+		files []string
+		// want は"ファイル:行: メッセージ"の形の報告
+		want []string
+	}{
+		{
+			name: "string keys collide between packages",
+			dir:  "appliedvalue/bad",
+			want: []string{
+				"fuga/fuga.go:9: context key has built-in type string; use a value of an unexported type",
+				"fuga/fuga.go:13: context key has built-in type string; use a value of an unexported type",
+				"hoge/hoge.go:9: context key has built-in type string; use a value of an unexported type",
+				"hoge/hoge.go:13: context key has built-in type string; use a value of an unexported type",
+			},
+		},
+		{
+			name: "unexported struct keys",
+			dir:  "appliedvalue/good",
+		},
+		{
+			name:  "string keys of request-scoped values",
+			dir:   "value",
+			files: []string{"context.go"},
+			want: []string{
+				"context.go:27: context key has built-in type string; use a value of an unexported type",
+				"context.go:27: context key has built-in type string; use a value of an unexported type",
+				"context.go:27: context key has built-in type string; use a value of an unexported type",
+				"context.go:36: context key has built-in type string; use a value of an unexported type",
+				"context.go:37: context key has built-in type string; use a value of an unexported type",
+				"context.go:38: context key has built-in type string; use a value of an unexported type",
+			},
+		},
+		{
+			name:  "unexported int key",
+			dir:   "value",
+			files: []string{"context1.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := copySample(t, tt.dir, tt.files)
+			results := analysistest.RunWithSuggestedFixes(recorder{t}, dir, ctxkey.Analyzer, "./...")
+
+			var got []string
+			for _, r := range results {
+				for _, d := range r.Diagnostics {
+					pos := r.Pass.Fset.Position(d.Pos)
+					rel, err := filepath.Rel(dir, pos.Filename)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, fmt.Sprintf("%s:%d: %s", filepath.ToSlash(rel), pos.Line, d.Message))
+				}
+			}
+			slices.Sort(got)
+			want := slices.Sorted(slices.Values(tt.want))
+			if !slices.Equal(got, want) {
+				t.Errorf("diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+// copySample はサンプルコードとその.goldenファイルを一時ディレクトリに複製し、そのディレクトリを返す
+// go.modがなければ作る
+func copySample(t *testing.T, dir string, files []string) string {
+	t.Helper()
+	tmp := t.TempDir()
+	src := filepath.Join(samples, dir)
+	if len(files) == 0 {
+		if err := os.CopyFS(tmp, os.DirFS(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(filepath.Join(src, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tmp, f), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "go.mod")); err != nil {
+		gomod := fmt.Sprintf("module %s\n\ngo 1.16\n", filepath.Base(dir))
+		if err := os.WriteFile(filepath.Join(tmp, "go.mod"), []byte(gomod), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	golden := filepath.Join("testdata", "golden", dir)
+	if _, err := os.Stat(golden); err == nil {
+		if err := os.CopyFS(tmp, os.DirFS(golden)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tmp
+}
+
+// recorder はanalysistestのエラーをtに報告する
+// サンプルコードにはwantコメントがないので、wantに対応しない報告のエラーは無視し、
+// 報告はTestSamplesで直接確かめる
+type recorder struct {
+	t *testing.T
+}
+
+func (r recorder) Errorf(format string, args ...any) {
+	r.t.Helper()
+	msg := fmt.Sprintf(format, args...)
+	if strings.Contains(msg, ": unexpected diagnostic: ") {
+		return
+	}
+	r.t.Errorf("%s", msg)
+}
@@ -0,0 +1,48 @@
+package keys
+
+import (
+	"context"
+	"net/http"
+)
+
+type (
+	ctxKey    struct{}
+	ctxIntKey int
+
+	// Key はエクスポートされているので、ほかのパッケージからも同じキーを作れる
+	Key string
+)
+
+const (
+	requestID ctxIntKey = iota
+	UserKey   Key       = "user"
+)
+
+type session string
+
+func keys(ctx context.Context, key string, r *http.Request) {
+	ctx = context.WithValue(ctx, "userID", 1) // want `context key has built-in type string; use a value of an unexported type`
+	_ = ctx.Value("userID")                   // want `context key has built-in type string; use a value of an unexported type`
+	_ = ctx.Value(1)                          // want `context key has built-in type int; use a value of an unexported type`
+	_ = ctx.Value(key)                        // want `context key has built-in type string; use a value of an unexported type`
+	_ = ctx.Value(UserKey)                    // want `context key has exported type Key; use a value of an unexported type`
+
+	// context.Contextを実装した型のValueも対象になる
+	c := wrappedContext{ctx}
+	_ = c.Value("userID") // want `context key has built-in type string; use a value of an unexported type`
+
+	// 非公開の型のキーは問題ない
+	ctx = context.WithValue(ctx, ctxKey{}, "a")
+	_ = ctx.Value(ctxKey{})
+	_ = ctx.Value(requestID)
+	_ = ctx.Value(session("id"))
+	_ = r.Context().Value(http.ServerContextKey)
+
+	// nilは型がないので報告しない
+	_ = context.WithValue(ctx, nil, "a")
+	_ = ctx.Value(nil)
+}
+
+type wrappedContext struct {
+	context.Context
+}
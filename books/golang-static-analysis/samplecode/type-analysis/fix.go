@@ -0,0 +1,181 @@
+package slogger
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/analysis"
+
+	"slogger/internal/passutil"
+)
+
+// methodTemplate は不足しているメソッドの引数と、埋め込んだハンドラへの呼び出し
+var methodTemplate = map[string]struct {
+	param string // slogパッケージはファイル内の名前に置き換える
+	call  string
+}{
+	"WithAttrs": {param: "attrs []slog.Attr", call: "WithAttrs(attrs)"},
+	"WithGroup": {param: "name string", call: "WithGroup(name)"},
+}
+
+// suggestMethod は型tsに不足しているメソッドmethodを追加する修正を返す
+// 追加するメソッドは埋め込まれたslog.Handlerに処理を任せ、外側の型で包み直したものを返す
+// 埋め込まれたslog.Handlerが見つからない場合はnilを返す
+func suggestMethod(pass *analysis.Pass, ts *ast.TypeSpec, named *types.Named, slogHandler *types.Interface, method string) []analysis.SuggestedFix {
+	file := passutil.FileOf(pass, ts.Pos())
+	if file == nil {
+		return nil
+	}
+	slogName := importName(file, "log/slog")
+	if slogName == "" || slogName == "." || slogName == "_" {
+		return nil
+	}
+	st, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	field := embeddedHandler(st, slogHandler)
+	if field == nil {
+		return nil
+	}
+
+	tmpl := methodTemplate[method]
+	recv, pointer := receiverOf(pass, file, named)
+	typeName := ts.Name.Name + typeParamNames(ts)
+	call := fmt.Sprintf("%s.%s.%s", recv, field.Name(), tmpl.call)
+
+	var body string
+	switch {
+	case st.NumFields() == 1 && pointer:
+		body = fmt.Sprintf("return &%s{%s: %s}", typeName, field.Name(), call)
+	case st.NumFields() == 1:
+		body = fmt.Sprintf("return %s{%s: %s}", typeName, field.Name(), call)
+	case pointer:
+		// ほかのフィールドを引き継ぐため、レシーバーをコピーしてから差し替える
+		body = fmt.Sprintf("clone := *%s\n\tclone.%s = %s\n\treturn &clone", recv, field.Name(), call)
+	default:
+		body = fmt.Sprintf("%s.%s = %s\n\treturn %s", recv, field.Name(), call, recv)
+	}
+
+	star := ""
+	if pointer {
+		star = "*"
+	}
+	text := fmt.Sprintf("\n\nfunc (%s %s%s) %s(%s) %s.Handler {\n\t%s\n}",
+		recv, star, typeName, method, strings.ReplaceAll(tmpl.param, "slog.", slogName+"."), slogName, body)
+
+	pos := insertPos(pass, file, ts, named)
+	return []analysis.SuggestedFix{{
+		Message: fmt.Sprintf("Add %s method", method),
+		TextEdits: []analysis.TextEdit{{
+			Pos:     pos,
+			End:     pos,
+			NewText: []byte(text),
+		}},
+	}}
+}
+
+// importName はファイル内でpathのパッケージを参照するときの名前を返す
+func importName(file *ast.File, path string) string {
+	for _, spec := range file.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || p != path {
+			continue
+		}
+		if spec.Name != nil {
+			return spec.Name.Name
+		}
+		return path[strings.LastIndex(path, "/")+1:]
+	}
+	return ""
+}
+
+// embeddedHandler はslog.Handlerを実装するインターフェース型の埋め込みフィールドを返す
+func embeddedHandler(st *types.Struct, slogHandler *types.Interface) *types.Var {
+	for f := range st.Fields() {
+		if !f.Embedded() || !types.IsInterface(f.Type()) {
+			continue
+		}
+		if types.Implements(f.Type(), slogHandler) {
+			return f
+		}
+	}
+	return nil
+}
+
+// receiverOf は宣言済みのメソッドに合わせたレシーバー名と、ポインタレシーバーかどうかを返す
+// メソッドがなければ型名の頭文字とポインタレシーバーを使う
+func receiverOf(pass *analysis.Pass, file *ast.File, named *types.Named) (string, bool) {
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || !isMethodOf(pass, fd, named) {
+			continue
+		}
+		field := fd.Recv.List[0]
+		if len(field.Names) == 0 || field.Names[0].Name == "_" {
+			continue
+		}
+		_, pointer := field.Type.(*ast.StarExpr)
+		return field.Names[0].Name, pointer
+	}
+	name := []rune(named.Obj().Name())
+	return string(unicode.ToLower(name[0])), true
+}
+
+// isMethodOf はfdがnamedのメソッドの宣言かどうかを返す
+func isMethodOf(pass *analysis.Pass, fd *ast.FuncDecl, named *types.Named) bool {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return false
+	}
+	expr := fd.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch x := expr.(type) {
+	case *ast.IndexExpr:
+		expr = x.X
+	case *ast.IndexListExpr:
+		expr = x.X
+	}
+	id, ok := expr.(*ast.Ident)
+	return ok && pass.TypesInfo.ObjectOf(id) == named.Origin().Obj()
+}
+
+// typeParamNames はジェネリック型のレシーバーに付ける"[K, V]"を返す
+func typeParamNames(ts *ast.TypeSpec) string {
+	if ts.TypeParams == nil {
+		return ""
+	}
+	var names []string
+	for _, field := range ts.TypeParams.List {
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// insertPos は追加するメソッドの位置を返す
+// 同じファイルにある最後のメソッドの後ろ、なければ型宣言の後ろに追加する
+func insertPos(pass *analysis.Pass, file *ast.File, ts *ast.TypeSpec, named *types.Named) token.Pos {
+	var pos token.Pos
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && isMethodOf(pass, fd, named) && fd.End() > pos {
+			pos = fd.End()
+		}
+	}
+	if pos.IsValid() {
+		return pos
+	}
+	for _, decl := range file.Decls {
+		if decl.Pos() <= ts.Pos() && ts.End() <= decl.End() {
+			return decl.End()
+		}
+	}
+	return ts.End()
+}
@@ -0,0 +1,19 @@
+// Package passutil provides helpers shared by the analyzers of this module.
+package passutil
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// FileOf returns the file of pass that contains pos, or nil if there is none.
+func FileOf(pass *analysis.Pass, pos token.Pos) *ast.File {
+	for _, f := range pass.Files {
+		if f.FileStart <= pos && pos < f.FileEnd {
+			return f
+		}
+	}
+	return nil
+}
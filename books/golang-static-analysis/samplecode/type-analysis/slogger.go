@@ -6,6 +6,7 @@ import (
 	"go/types"
 
 	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
 	"golang.org/x/tools/go/analysis/passes/inspect"
 	"golang.org/x/tools/go/ast/inspector"
 )
@@ -19,9 +20,20 @@ var Analyzer = &analysis.Analyzer{
 	Run:  run,
 	Requires: []*analysis.Analyzer{
 		inspect.Analyzer,
+		buildssa.Analyzer,
 	},
 }
 
+var (
+	checkRecord  bool // -record
+	checkEnabled bool // -enabled
+)
+
+func init() {
+	Analyzer.Flags.BoolVar(&checkRecord, "record", true, "report Handle methods that modify a slog.Record they retain or pass to multiple handlers without Clone")
+	Analyzer.Flags.BoolVar(&checkEnabled, "enabled", true, "report handlers that override Handle but do not delegate Enabled to the embedded slog.Handler")
+}
+
 func run(pass *analysis.Pass) (any, error) {
 	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
 
@@ -44,9 +56,15 @@ func run(pass *analysis.Pass) (any, error) {
 	var (
 		withAttrFunc  *types.Func
 		withGroupFunc *types.Func
+		handleFunc    *types.Func
+		enabledFunc   *types.Func
 	)
 	for m := range slogHandlerInterface.Methods() {
 		switch m.Name() {
+		case "Handle":
+			handleFunc = m
+		case "Enabled":
+			enabledFunc = m
 		case "WithAttrs":
 			withAttrFunc = m
 		case "WithGroup":
@@ -72,6 +90,15 @@ func run(pass *analysis.Pass) (any, error) {
 			return
 		}
 		typ := obj.Type()
+		// 別名はメソッドを宣言できないので、元の型を宣言した場所で検査する
+		namedTyp, ok := typ.(*types.Named)
+		if !ok {
+			return
+		}
+		// インターフェース型はslog.Handlerを実装していても対象外
+		if types.IsInterface(typ) {
+			return
+		}
 		pointerTyp := types.NewPointer(typ)
 
 		// slog.Handlerを実装しているか確認
@@ -81,31 +108,46 @@ func run(pass *analysis.Pass) (any, error) {
 
 		// fmt.Printf("%s implements slog.Handler\n", tsIdent.Name)
 
-		namedTyp, _ := typ.(*types.Named)
-
-		var hasWithAttrs bool
-		for m := range namedTyp.Methods() {
-			if m.Name() == "WithAttrs" && types.Identical(m.Signature(), withAttrFunc.Signature()) {
-				hasWithAttrs = true
-				break
-			}
-		}
-
-		var hasWithGroup bool
-		for m := range namedTyp.Methods() {
-			if m.Name() == "WithGroup" && types.Identical(m.Signature(), withGroupFunc.Signature()) {
-				hasWithGroup = true
-				break
-			}
-		}
+		// *Tのメソッド集合にはTとその埋め込みフィールドから昇格したメソッドもすべて含まれる
+		mset := types.NewMethodSet(pointerTyp)
+		hasWithAttrs := implementsMethod(mset, withAttrFunc)
+		hasWithGroup := implementsMethod(mset, withGroupFunc)
 
 		if !hasWithAttrs {
-			pass.Reportf(n.Pos(), "%s implements slog.Handler but does not implement WithAttrs method", tsIdent.Name)
+			pass.Report(analysis.Diagnostic{
+				Pos:            n.Pos(),
+				Message:        fmt.Sprintf("%s implements slog.Handler but does not implement WithAttrs method", tsIdent.Name),
+				SuggestedFixes: suggestMethod(pass, ts, namedTyp, slogHandlerInterface, "WithAttrs"),
+			})
 		}
 		if !hasWithGroup {
-			pass.Reportf(n.Pos(), "%s implements slog.Handler but does not implement WithGroup method", tsIdent.Name)
+			pass.Report(analysis.Diagnostic{
+				Pos:            n.Pos(),
+				Message:        fmt.Sprintf("%s implements slog.Handler but does not implement WithGroup method", tsIdent.Name),
+				SuggestedFixes: suggestMethod(pass, ts, namedTyp, slogHandlerInterface, "WithGroup"),
+			})
 		}
 	})
 
+	checkWrapperReturns(pass, slogHandlerInterface, withAttrFunc, withGroupFunc)
+	if checkRecord {
+		checkRecordMutation(pass, inspect, slogHandlerInterface, handleFunc)
+	}
+	if checkEnabled {
+		checkEnabledDelegation(pass, inspect, slogHandlerInterface, handleFunc, enabledFunc)
+	}
+
 	return nil, nil
 }
+
+// implementsMethod はmsetがmと同じシグネチャのメソッドを具象型で実装しているかを返す
+// 埋め込んだslog.Handlerなどのインターフェースから昇格したメソッドは、
+// 外側の型で包み直さないので実装していないものとして扱う
+func implementsMethod(mset *types.MethodSet, m *types.Func) bool {
+	sel := mset.Lookup(m.Pkg(), m.Name())
+	if sel == nil || !types.Identical(sel.Type(), m.Signature()) {
+		return false
+	}
+	recv := sel.Obj().(*types.Func).Signature().Recv()
+	return recv != nil && !types.IsInterface(recv.Type())
+}
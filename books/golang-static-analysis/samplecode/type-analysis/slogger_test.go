@@ -33,6 +33,38 @@ func TestAnalyzer(t *testing.T) {
 			name:    "missing both WithAttrs and WithGroup methods",
 			pkgPath: "missing_both",
 		},
+		{
+			name:    "fixes keep the other fields and the receiver style",
+			pkgPath: "fix_fields",
+		},
+		{
+			name:    "WithAttrs and WithGroup that lose the wrapper",
+			pkgPath: "wrapper_lost",
+		},
+		{
+			name:    "WithAttrs and WithGroup that keep the wrapper",
+			pkgPath: "wrapper_kept",
+		},
+		{
+			name:    "methods promoted from embedded fields",
+			pkgPath: "promoted",
+		},
+		{
+			name:    "generic handler types",
+			pkgPath: "generic_handler",
+		},
+		{
+			name:    "type aliases",
+			pkgPath: "alias_handler",
+		},
+		{
+			name:    "Handle that modifies a shared record",
+			pkgPath: "handle_record",
+		},
+		{
+			name:    "Enabled that does not delegate to the embedded handler",
+			pkgPath: "handle_enabled",
+		},
 	}
 
 	for _, tt := range tests {
@@ -41,3 +73,54 @@ func TestAnalyzer(t *testing.T) {
 		})
 	}
 }
+
+// TestFlags checks that each check can be turned off by its flag.
+func TestFlags(t *testing.T) {
+	testdata := testutil.WithModules(t, analysistest.TestData(), nil)
+
+	tests := []struct {
+		flag    string
+		pkgPath string
+	}{
+		{flag: "record", pkgPath: "record_off"},
+		{flag: "enabled", pkgPath: "enabled_off"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag, func(t *testing.T) {
+			// 無効にした検査の報告だけがなくなり、もう一方の検査は報告される
+			setFlag(t, tt.flag, "false")
+			analysistest.Run(t, testdata, slogger.Analyzer, tt.pkgPath)
+		})
+	}
+}
+
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	f := slogger.Analyzer.Flags.Lookup(name)
+	old := f.Value.String()
+	if err := f.Value.Set(value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Value.Set(old) })
+}
+
+// TestSuggestedFixes checks the fixes against the .golden files.
+func TestSuggestedFixes(t *testing.T) {
+	// testutil.WithModulesはコピーしたファイルの先頭に//lineディレクティブを加え、
+	// それが修正後のファイルにも残ってしまうので、ここではtestdataをそのまま使う
+	// 標準ライブラリしか使わないので、GOPATHモードでも読み込める
+	testdata := analysistest.TestData()
+
+	for _, pkgPath := range []string{
+		"missing_withattrs",
+		"missing_withgroup",
+		"missing_both",
+		"fix_fields",
+		"generic_handler",
+	} {
+		t.Run(pkgPath, func(t *testing.T) {
+			analysistest.RunWithSuggestedFixes(t, testdata, slogger.Analyzer, pkgPath)
+		})
+	}
+}
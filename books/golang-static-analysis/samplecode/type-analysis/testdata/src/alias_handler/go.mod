@@ -0,0 +1,3 @@
+module alias_handler
+
+go 1.24.0
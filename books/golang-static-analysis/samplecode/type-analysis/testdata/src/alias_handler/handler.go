@@ -0,0 +1,44 @@
+package alias_handler
+
+import (
+	"log/slog"
+)
+
+type TraceHandler struct {
+	slog.Handler
+}
+
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &TraceHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	return &TraceHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// 別名は元の型を宣言した場所で検査されるので、ここでは報告しない
+type (
+	Alias        = TraceHandler
+	PointerAlias = *TraceHandler
+	HandlerAlias = slog.Handler
+	StructAlias  = struct{ slog.Handler }
+)
+
+type GenericHandler[T any] struct { // want "GenericHandler implements slog.Handler but does not implement WithAttrs method" "GenericHandler implements slog.Handler but does not implement WithGroup method"
+	slog.Handler
+}
+
+type IntHandler = GenericHandler[int]
+
+// 別名で埋め込んでもslog.Handlerから昇格したメソッドになる
+type AliasEmbed struct { // want "AliasEmbed implements slog.Handler but does not implement WithAttrs method" "AliasEmbed implements slog.Handler but does not implement WithGroup method"
+	HandlerAlias
+}
+
+// 具象型の別名を埋め込めば、そのメソッドが昇格する
+type AliasWrapped struct {
+	*Alias
+}
+
+// 名前付きのインターフェース型は対象外
+type Iface HandlerAlias
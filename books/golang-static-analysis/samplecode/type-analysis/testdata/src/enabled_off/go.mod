@@ -0,0 +1,3 @@
+module enabled_off
+
+go 1.24.0
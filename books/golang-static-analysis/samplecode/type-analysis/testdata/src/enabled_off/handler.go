@@ -0,0 +1,33 @@
+package enabled_off
+
+import (
+	"context"
+	"log/slog"
+)
+
+// TeeHandler はHandleとEnabledの両方の検査に引っかかる
+type TeeHandler struct {
+	slog.Handler
+	other slog.Handler
+	level slog.Level
+}
+
+func (h *TeeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *TeeHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(slog.String("handler", "tee")) // want "TeeHandler.Handle modifies the record r that it retains or passes to multiple handlers; call r.Clone\\(\\) first"
+	if err := h.other.Handle(ctx, r); err != nil {
+		return err
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *TeeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &TeeHandler{Handler: h.Handler.WithAttrs(attrs), other: h.other.WithAttrs(attrs), level: h.level}
+}
+
+func (h *TeeHandler) WithGroup(name string) slog.Handler {
+	return &TeeHandler{Handler: h.Handler.WithGroup(name), other: h.other.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,3 @@
+module fix_fields
+
+go 1.24.0
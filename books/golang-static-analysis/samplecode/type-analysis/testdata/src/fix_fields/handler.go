@@ -0,0 +1,31 @@
+package fix_fields
+
+import (
+	"context"
+	xslog "log/slog"
+)
+
+// LevelHandler は値レシーバーで、埋め込み以外のフィールドを持つ
+type LevelHandler struct { // want "LevelHandler implements slog.Handler but does not implement WithAttrs method" "LevelHandler implements slog.Handler but does not implement WithGroup method"
+	xslog.Handler
+	level xslog.Level
+}
+
+func (l LevelHandler) Enabled(ctx context.Context, level xslog.Level) bool {
+	return level >= l.level && l.Handler.Enabled(ctx, level)
+}
+
+// PrefixHandler はポインタレシーバーで、埋め込み以外のフィールドを持つ
+type PrefixHandler struct { // want "PrefixHandler implements slog.Handler but does not implement WithGroup method"
+	xslog.Handler
+	prefix string
+}
+
+func (p *PrefixHandler) Handle(ctx context.Context, r xslog.Record) error {
+	r.Message = p.prefix + r.Message
+	return p.Handler.Handle(ctx, r)
+}
+
+func (p *PrefixHandler) WithAttrs(attrs []xslog.Attr) xslog.Handler {
+	return &PrefixHandler{Handler: p.Handler.WithAttrs(attrs), prefix: p.prefix}
+}
@@ -0,0 +1,3 @@
+module generic_handler
+
+go 1.24.0
@@ -0,0 +1,47 @@
+package generic_handler
+
+import (
+	"context"
+	"log/slog"
+)
+
+// FilterHandler は型パラメータを持つハンドラ
+type FilterHandler[T any] struct { // want "FilterHandler implements slog.Handler but does not implement WithGroup method"
+	slog.Handler
+	keep func(T) bool
+}
+
+func (h *FilterHandler[T]) Handle(ctx context.Context, r slog.Record) error {
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *FilterHandler[T]) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &FilterHandler[T]{Handler: h.Handler.WithAttrs(attrs), keep: h.keep}
+}
+
+// PairHandler は型パラメータが複数あるハンドラ
+type PairHandler[K comparable, V any] struct {
+	slog.Handler
+}
+
+func (h PairHandler[K, V]) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return PairHandler[K, V]{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h PairHandler[K, V]) WithGroup(name string) slog.Handler {
+	return h.Handler.WithGroup(name) // want "PairHandler.WithGroup returns a handler that is not a PairHandler, so the wrapper is lost"
+}
+
+// EmptyHandler はメソッドを何も宣言していない
+type EmptyHandler[T any] struct { // want "EmptyHandler implements slog.Handler but does not implement WithAttrs method" "EmptyHandler implements slog.Handler but does not implement WithGroup method"
+	slog.Handler
+}
+
+// 具体化した型を埋め込んでも、WithAttrsとWithGroupは具象型から昇格する
+type IntFilter struct {
+	*FilterHandler[int]
+}
+
+func (h *IntFilter) WithGroup(name string) slog.Handler {
+	return &IntFilter{FilterHandler: &FilterHandler[int]{Handler: h.Handler.WithGroup(name), keep: h.keep}}
+}
@@ -0,0 +1,3 @@
+module handle_enabled
+
+go 1.24.0
@@ -0,0 +1,91 @@
+package handle_enabled
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LevelHandler のEnabledは埋め込んだハンドラのEnabledを呼んでいない
+type LevelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h *LevelHandler) Enabled(ctx context.Context, level slog.Level) bool { // want "LevelHandler overrides Handle but its Enabled does not call Enabled of the embedded slog.Handler"
+	return level >= h.level
+}
+
+func (h *LevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LevelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *LevelHandler) WithGroup(name string) slog.Handler {
+	return &LevelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// FilterHandler はEnabledで委譲している
+type FilterHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h *FilterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h *FilterHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *FilterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &FilterHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *FilterHandler) WithGroup(name string) slog.Handler {
+	return &FilterHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// CheckHandler はHandleの中で埋め込んだハンドラのEnabledを確認している
+type CheckHandler struct {
+	slog.Handler
+}
+
+func (h CheckHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h CheckHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h CheckHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return CheckHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h CheckHandler) WithGroup(name string) slog.Handler {
+	return CheckHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// TraceHandler はEnabledを上書きしていないので、埋め込んだハンドラのEnabledが使われる
+type TraceHandler struct {
+	slog.Handler
+}
+
+func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &TraceHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	return &TraceHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,3 @@
+module handle_record
+
+go 1.24.0
@@ -0,0 +1,117 @@
+package handle_record
+
+import (
+	"context"
+	"log/slog"
+)
+
+// FanoutHandler は変更したRecordを複数のハンドラに渡している
+type FanoutHandler struct {
+	slog.Handler
+	others []slog.Handler
+}
+
+func (h *FanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(slog.String("handler", "fanout")) // want "FanoutHandler.Handle modifies the record r that it retains or passes to multiple handlers; call r.Clone\\(\\) first"
+	for _, o := range h.others {
+		if err := o.Handle(ctx, r); err != nil {
+			return err
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *FanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &FanoutHandler{Handler: h.Handler.WithAttrs(attrs), others: h.others}
+}
+
+func (h *FanoutHandler) WithGroup(name string) slog.Handler {
+	return &FanoutHandler{Handler: h.Handler.WithGroup(name), others: h.others}
+}
+
+// BufferHandler は変更したRecordを保持している
+type BufferHandler struct {
+	slog.Handler
+	records *[]slog.Record
+}
+
+func (h *BufferHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.Add("buffered", true) // want "BufferHandler.Handle modifies the record r that it retains or passes to multiple handlers; call r.Clone\\(\\) first"
+	*h.records = append(*h.records, r)
+	return nil
+}
+
+func (h *BufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &BufferHandler{Handler: h.Handler.WithAttrs(attrs), records: h.records}
+}
+
+func (h *BufferHandler) WithGroup(name string) slog.Handler {
+	return &BufferHandler{Handler: h.Handler.WithGroup(name), records: h.records}
+}
+
+// AsyncHandler は変更したRecordを別のゴルーチンに渡している
+type AsyncHandler struct {
+	slog.Handler
+}
+
+func (h *AsyncHandler) Handle(ctx context.Context, rec slog.Record) error {
+	rec.AddAttrs(slog.Bool("async", true)) // want "AsyncHandler.Handle modifies the record rec that it retains or passes to multiple handlers; call rec.Clone\\(\\) first"
+	go func() {
+		_ = h.Handler.Handle(ctx, rec)
+	}()
+	return nil
+}
+
+func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &AsyncHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *AsyncHandler) WithGroup(name string) slog.Handler {
+	return &AsyncHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// TeeHandler は複製してから変更しているので問題ない
+type TeeHandler struct {
+	slog.Handler
+	other slog.Handler
+}
+
+func (h *TeeHandler) Handle(ctx context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(slog.String("handler", "tee"))
+	if err := h.other.Handle(ctx, r); err != nil {
+		return err
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *TeeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &TeeHandler{Handler: h.Handler.WithAttrs(attrs), other: h.other}
+}
+
+func (h *TeeHandler) WithGroup(name string) slog.Handler {
+	return &TeeHandler{Handler: h.Handler.WithGroup(name), other: h.other}
+}
+
+// CopyHandler は変更しないRecordを複数のハンドラに渡し、変更は複製に対して行う
+type CopyHandler struct {
+	slog.Handler
+	other slog.Handler
+}
+
+func (h *CopyHandler) Handle(ctx context.Context, r slog.Record) error {
+	if err := h.other.Handle(ctx, r); err != nil {
+		return err
+	}
+	r2 := r.Clone()
+	r2.AddAttrs(slog.String("handler", "copy"))
+	return h.Handler.Handle(ctx, r2)
+}
+
+func (h *CopyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &CopyHandler{Handler: h.Handler.WithAttrs(attrs), other: h.other}
+}
+
+func (h *CopyHandler) WithGroup(name string) slog.Handler {
+	return &CopyHandler{Handler: h.Handler.WithGroup(name), other: h.other}
+}
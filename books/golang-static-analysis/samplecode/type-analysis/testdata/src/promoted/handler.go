@@ -0,0 +1,53 @@
+package promoted
+
+import (
+	"context"
+	"log/slog"
+)
+
+// base はWithAttrsとWithGroupを実装している
+type base struct {
+	slog.Handler
+}
+
+func (b *base) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &base{Handler: b.Handler.WithAttrs(attrs)}
+}
+
+func (b *base) WithGroup(name string) slog.Handler {
+	return &base{Handler: b.Handler.WithGroup(name)}
+}
+
+// Wrapped のWithAttrsとWithGroupは具象型の*baseから昇格している
+type Wrapped struct {
+	*base
+}
+
+func (w *Wrapped) Handle(ctx context.Context, r slog.Record) error {
+	return w.base.Handle(ctx, r)
+}
+
+// Inner はslog.Handlerを埋め込んでいるだけ
+type Inner struct { // want "Inner implements slog.Handler but does not implement WithAttrs method" "Inner implements slog.Handler but does not implement WithGroup method"
+	slog.Handler
+}
+
+// Outer のWithAttrsとWithGroupは具象型を経由しているが、元はslog.Handlerのもの
+type Outer struct { // want "Outer implements slog.Handler but does not implement WithAttrs method" "Outer implements slog.Handler but does not implement WithGroup method"
+	Inner
+}
+
+// handler はslog.Handlerを埋め込んだインターフェース
+type handler interface {
+	slog.Handler
+	Name() string
+}
+
+type NamedHandler struct { // want "NamedHandler implements slog.Handler but does not implement WithAttrs method" "NamedHandler implements slog.Handler but does not implement WithGroup method"
+	handler
+}
+
+// Logger はインターフェース型なので対象外
+type Logger interface {
+	slog.Handler
+}
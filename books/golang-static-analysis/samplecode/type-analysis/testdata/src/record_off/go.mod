@@ -0,0 +1,3 @@
+module record_off
+
+go 1.24.0
@@ -0,0 +1,33 @@
+package record_off
+
+import (
+	"context"
+	"log/slog"
+)
+
+// TeeHandler はHandleとEnabledの両方の検査に引っかかる
+type TeeHandler struct {
+	slog.Handler
+	other slog.Handler
+	level slog.Level
+}
+
+func (h *TeeHandler) Enabled(ctx context.Context, level slog.Level) bool { // want "TeeHandler overrides Handle but its Enabled does not call Enabled of the embedded slog.Handler"
+	return level >= h.level
+}
+
+func (h *TeeHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(slog.String("handler", "tee"))
+	if err := h.other.Handle(ctx, r); err != nil {
+		return err
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *TeeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &TeeHandler{Handler: h.Handler.WithAttrs(attrs), other: h.other.WithAttrs(attrs), level: h.level}
+}
+
+func (h *TeeHandler) WithGroup(name string) slog.Handler {
+	return &TeeHandler{Handler: h.Handler.WithGroup(name), other: h.other.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,3 @@
+module wrapper_kept
+
+go 1.24.0
@@ -0,0 +1,57 @@
+package wrapper_kept
+
+import (
+	"context"
+	"log/slog"
+)
+
+// TraceHandler はレシーバーと同じ型で包み直している
+type TraceHandler struct {
+	slog.Handler
+}
+
+func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	traceID, ok := ctx.Value("traceID").(string)
+	if ok && traceID != "" {
+		r.AddAttrs(slog.String("traceID", traceID))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &TraceHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	var next slog.Handler = h
+	if name != "" {
+		next = &TraceHandler{Handler: h.Handler.WithGroup(name)}
+	}
+	return next
+}
+
+// LevelHandler は値レシーバーで、ほかのフィールドを引き継ぐ
+type LevelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h LevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.Handler = h.Handler.WithAttrs(attrs)
+	return h
+}
+
+func (h LevelHandler) WithGroup(name string) slog.Handler {
+	return h.with(h.Handler.WithGroup(name))
+}
+
+func (h LevelHandler) with(next slog.Handler) slog.Handler {
+	return LevelHandler{Handler: next, level: h.level}
+}
@@ -0,0 +1,3 @@
+module wrapper_lost
+
+go 1.24.0
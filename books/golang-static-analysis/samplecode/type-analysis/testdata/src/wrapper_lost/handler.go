@@ -0,0 +1,69 @@
+package wrapper_lost
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// TraceHandler は埋め込んだハンドラの結果をそのまま返している
+type TraceHandler struct {
+	slog.Handler
+}
+
+func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	traceID, ok := ctx.Value("traceID").(string)
+	if ok && traceID != "" {
+		r.AddAttrs(slog.String("traceID", traceID))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.Handler.WithAttrs(attrs) // want "TraceHandler.WithAttrs returns a handler that is not a TraceHandler, so the wrapper is lost"
+}
+
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h.Handler // want "TraceHandler.WithGroup returns a handler that is not a TraceHandler, so the wrapper is lost"
+	}
+	return &TraceHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// BranchHandler は分岐の片方でだけ包み直していない
+type BranchHandler struct {
+	slog.Handler
+}
+
+func (h BranchHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var next slog.Handler = BranchHandler{Handler: h.Handler.WithAttrs(attrs)}
+	if len(attrs) > 1 {
+		next = h.Handler.WithAttrs(attrs[:1])
+	}
+	return next // want "BranchHandler.WithAttrs returns a handler that is not a BranchHandler, so the wrapper is lost"
+}
+
+func (h BranchHandler) WithGroup(name string) slog.Handler {
+	return h.inner().WithGroup(name) // want "BranchHandler.WithGroup returns a handler that is not a BranchHandler, so the wrapper is lost"
+}
+
+func (h BranchHandler) inner() slog.Handler {
+	return h.Handler
+}
+
+// ReplaceHandler は別のハンドラを作って返している
+type ReplaceHandler struct {
+	slog.Handler
+}
+
+func (h *ReplaceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return slog.NewTextHandler(os.Stderr, nil) // want "ReplaceHandler.WithAttrs returns a handler that is not a ReplaceHandler, so the wrapper is lost"
+}
+
+func (h *ReplaceHandler) WithGroup(name string) slog.Handler {
+	return unwrap(h, name) // want "ReplaceHandler.WithGroup returns a handler that is not a ReplaceHandler, so the wrapper is lost"
+}
+
+func unwrap(h *ReplaceHandler, name string) slog.Handler {
+	return slog.NewJSONHandler(os.Stderr, nil)
+}
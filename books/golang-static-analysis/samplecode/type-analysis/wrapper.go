@@ -0,0 +1,121 @@
+package slogger
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+// checkWrapperReturns はWithAttrsとWithGroupの戻り値をSSAでたどり、
+// レシーバーと同じ型ではないハンドラを返しているreturn文を報告する
+// 埋め込んだハンドラのWithAttrsの結果をそのまま返すと、外側のハンドラの処理が失われる
+func checkWrapperReturns(pass *analysis.Pass, slogHandler *types.Interface, withAttrs, withGroup *types.Func) {
+	ssaResult := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA)
+
+	for _, fn := range ssaResult.SrcFuncs {
+		recv := fn.Signature.Recv()
+		if recv == nil {
+			continue
+		}
+		var want *types.Func
+		switch fn.Name() {
+		case "WithAttrs":
+			want = withAttrs
+		case "WithGroup":
+			want = withGroup
+		default:
+			continue
+		}
+		if !sameSignature(fn.Signature, want.Signature()) {
+			continue
+		}
+		named := namedOf(recv.Type())
+		if named == nil {
+			continue
+		}
+		if !types.Implements(named, slogHandler) && !types.Implements(types.NewPointer(named), slogHandler) {
+			continue
+		}
+
+		for _, b := range fn.Blocks {
+			ret, ok := b.Instrs[len(b.Instrs)-1].(*ssa.Return)
+			if !ok || len(ret.Results) != 1 {
+				continue
+			}
+			if !losesWrapper(ret.Results[0], named, map[ssa.Value]bool{}) {
+				continue
+			}
+			pos := ret.Pos()
+			if !pos.IsValid() {
+				pos = fn.Pos()
+			}
+			pass.Reportf(pos, "%s.%s returns a handler that is not a %s, so the wrapper is lost",
+				named.Obj().Name(), fn.Name(), named.Obj().Name())
+		}
+	}
+}
+
+// sameSignature はレシーバーを除いたシグネチャが同じかどうかを返す
+func sameSignature(sig, want *types.Signature) bool {
+	return types.Identical(types.NewSignatureType(nil, nil, nil, sig.Params(), sig.Results(), sig.Variadic()), want)
+}
+
+// namedOf はtまたは*tの名前付き型を返す
+func namedOf(t types.Type) *types.Named {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, _ := types.Unalias(t).(*types.Named)
+	return named
+}
+
+// losesWrapper はvが取りうる値のどれかが、named以外のハンドラであることがわかればtrueを返す
+// 引数や他のパッケージの関数の結果のように、中身がわからない値は報告しない
+func losesWrapper(v ssa.Value, named *types.Named, seen map[ssa.Value]bool) bool {
+	if seen[v] {
+		return false
+	}
+	seen[v] = true
+
+	switch v := v.(type) {
+	case *ssa.MakeInterface:
+		// &T{...}やレシーバーそのものはここに来る
+		n := namedOf(v.X.Type())
+		return n == nil || n.Origin() != named.Origin()
+	case *ssa.ChangeInterface:
+		return losesWrapper(v.X, named, seen)
+	case *ssa.Phi:
+		for _, e := range v.Edges {
+			if losesWrapper(e, named, seen) {
+				return true
+			}
+		}
+		return false
+	case *ssa.UnOp:
+		// return h.Handler のように、埋め込んだハンドラを読み出している
+		_, field := v.X.(*ssa.FieldAddr)
+		return field
+	case *ssa.Field:
+		return true
+	case *ssa.Call:
+		// h.Handler.WithAttrs(attrs) のようなインターフェースのメソッド呼び出し
+		if v.Call.IsInvoke() {
+			return true
+		}
+		// 同じパッケージの関数は、その関数が返す値をたどる
+		callee := v.Call.StaticCallee()
+		if callee == nil || callee.Pkg != v.Parent().Pkg || len(callee.Blocks) == 0 {
+			return false
+		}
+		for _, b := range callee.Blocks {
+			ret, ok := b.Instrs[len(b.Instrs)-1].(*ssa.Return)
+			if ok && len(ret.Results) == 1 && losesWrapper(ret.Results[0], named, seen) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}